@@ -176,7 +176,11 @@ func TokenStatus(w http.ResponseWriter, r *http.Request) {
 // Returns:
 // Status code 200 on success
 func ChangeUsername(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
+	userID, ok := UserID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 	r.ParseForm()
 
 	usernameValues, ok := r.PostForm["username"]
@@ -269,7 +273,11 @@ func UsernameStatus(w http.ResponseWriter, r *http.Request) {
 // Returns:
 // Status code 200 on success
 func ChangePassword(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
+	userID, ok := UserID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 	r.ParseForm()
 
 	usernameValues, ok := r.PostForm["password"]
@@ -314,8 +322,28 @@ var JwtMiddleware = jwtmiddleware.New(jwtmiddleware.Options{
 	SigningMethod: jwt.SigningMethodHS256,
 })
 
-func getUserID(r *http.Request) int {
-	token := r.Context().Value("user").(*jwt.Token)
-	claims := token.Claims.(jwt.MapClaims)
-	return int(claims["user_id"].(float64))
+// OptionalJwtMiddleware generates wrapping handlers for routes which accept, but do not require authentication
+var OptionalJwtMiddleware = jwtmiddleware.New(jwtmiddleware.Options{
+	ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
+		return jwtSigningKey, nil
+	},
+	SigningMethod:       jwt.SigningMethodHS256,
+	CredentialsOptional: true,
+})
+
+// UserID returns the user id of the JWT validated by JwtMiddleware or OptionalJwtMiddleware, if any
+func UserID(r *http.Request) (int, bool) {
+	token, ok := r.Context().Value("user").(*jwt.Token)
+	if !ok || token == nil {
+		return 0, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int(userID), true
 }
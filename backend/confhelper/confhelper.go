@@ -8,28 +8,29 @@ import (
 )
 
 type config struct {
-	DbConnectionString string `json:"db_connection_string"`
-	JwtSecret          string `json:"jwt_secret"`
+	DbConnectionString string      `json:"db_connection_string"`
+	JwtSecret          string      `json:"jwt_secret"`
+	RSAKeyPool         map[int]int `json:"rsa_key_pool"`
 }
 
-// ParseConfig parses the JSON configuration
-func ParseConfig(relativeConfigPath string) (string, string, error) {
+// ParseConfig parses the JSON configuration, the RSA key pool maps key lengths to pool capacities
+func ParseConfig(relativeConfigPath string) (string, string, map[int]int, error) {
 	ex, err := os.Executable()
 	if err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
 	exPath := filepath.Dir(ex)
 	configPath := filepath.Join(exPath, relativeConfigPath)
 
 	dat, err := ioutil.ReadFile(configPath)
 	if err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
 
 	conf := config{}
 	if err := json.Unmarshal(dat, &conf); err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
 
-	return conf.DbConnectionString, conf.JwtSecret, nil
+	return conf.DbConnectionString, conf.JwtSecret, conf.RSAKeyPool, nil
 }
@@ -29,6 +29,28 @@ type Key struct {
 	CreatedOn time.Time
 }
 
+// IssuedCertificate data model
+type IssuedCertificate struct {
+	ID               int
+	CAKeyID          int
+	SerialNumber     string
+	Subject          string
+	Certificate      string
+	IssuedOn         time.Time
+	ExpiresOn        time.Time
+	RevokedOn        *time.Time
+	RevocationReason int
+}
+
+// Secret data model
+type Secret struct {
+	ID             string
+	Value          string
+	PassphraseSalt string
+	PassphraseHash string
+	ExpiresOn      time.Time
+}
+
 var db *sql.DB
 
 // InitializeDatabase connects to the SQL database and verifies the connection
@@ -50,7 +72,10 @@ func CreateUser(username, password string) (err error) {
 		return
 	}
 
-	salt := generatePasswordSalt()
+	salt, err := generatePasswordSalt()
+	if err != nil {
+		return
+	}
 	passwordHash, err := ComputePasswordHash(password, salt)
 	if err != nil {
 		return
@@ -169,7 +194,10 @@ func ChangePassword(userID int, password string) (err error) {
 		return
 	}
 
-	salt := generatePasswordSalt()
+	salt, err := generatePasswordSalt()
+	if err != nil {
+		return
+	}
 	passwordHash, err := ComputePasswordHash(password, salt)
 	if err != nil {
 		return
@@ -190,8 +218,8 @@ func ChangePassword(userID int, password string) (err error) {
 	return
 }
 
-// CreateKey persists a new key for this user
-func CreateKey(name, keyType, value string, userID int) (err error) {
+// CreateKey persists a new key for this user and returns its id
+func CreateKey(name, keyType, value string, userID int) (id int, err error) {
 	statement, err := db.Prepare("INSERT INTO user_keys (key_name, key_type, key_value, user_id, created_on) VALUES (?, (SELECT id FROM key_types WHERE key_type_name = ?), ?, ?, CURRENT_TIMESTAMP)")
 	if err != nil {
 		return
@@ -209,6 +237,43 @@ func CreateKey(name, keyType, value string, userID int) (err error) {
 		return
 	}
 
+	lastID, err := resource.LastInsertId()
+	id = int(lastID)
+	return
+}
+
+// CreateKeys persists new keys for this user in a single transaction and returns their ids
+func CreateKeys(names, values, keyTypes []string, userID int) (ids []int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	statement, err := tx.Prepare("INSERT INTO user_keys (key_name, key_type, key_value, user_id, created_on) VALUES (?, (SELECT id FROM key_types WHERE key_type_name = ?), ?, ?, CURRENT_TIMESTAMP)")
+	if err != nil {
+		return
+	}
+	defer statement.Close()
+
+	ids = make([]int, 0, len(names))
+	for i := range names {
+		var resource sql.Result
+		resource, err = statement.Exec(names[i], keyTypes[i], values[i], userID)
+		if err != nil {
+			return
+		}
+		var lastID int64
+		if lastID, err = resource.LastInsertId(); err != nil {
+			return
+		}
+		ids = append(ids, int(lastID))
+	}
+
+	err = tx.Commit()
 	return
 }
 
@@ -234,6 +299,20 @@ func FindKey(id int) (key *Key, err error) {
 	return
 }
 
+// FindOwnedKey returns key with provided id if it belongs to the user and has one of the key types, nil otherwise
+func FindOwnedKey(id, userID int, keyTypes ...string) (*Key, error) {
+	key, err := FindKey(id)
+	if err != nil || key == nil || key.UserID != userID {
+		return nil, err
+	}
+	for _, keyType := range keyTypes {
+		if key.Type == keyType {
+			return key, nil
+		}
+	}
+	return nil, nil
+}
+
 // FindAllKeys returns all keys for user with provided id
 func FindAllKeys(userID, offset, count int) (keys []Key, total int, err error) {
 	statement, err := db.Prepare("SELECT COUNT(*) FROM user_keys WHERE user_keys.user_id = ?")
@@ -299,6 +378,25 @@ func RenameKey(id int, name string) (err error) {
 	return
 }
 
+// ReplaceKeyValue changes the given key's value if it still has the expected value, reporting whether it was replaced
+func ReplaceKeyValue(id int, value, newValue string) (replaced bool, err error) {
+	statement, err := db.Prepare("UPDATE user_keys SET key_value = ? WHERE id = ? AND key_value = ?")
+	if err != nil {
+		return
+	}
+	resource, err := statement.Exec(newValue, id, value)
+	if err != nil {
+		return
+	}
+
+	rowCount, err := resource.RowsAffected()
+	if err != nil {
+		return
+	}
+	replaced = rowCount == 1
+	return
+}
+
 // DeleteKey deletes a key from the database
 func DeleteKey(id int) (err error) {
 	statement, err := db.Prepare("DELETE FROM user_keys WHERE id = ?")
@@ -321,12 +419,198 @@ func DeleteKey(id int) (err error) {
 	return
 }
 
+// CreateSecret persists a new encrypted one-time secret
+func CreateSecret(id, value, passphraseSalt, passphraseHash string, expiresOn time.Time) (err error) {
+	statement, err := db.Prepare("INSERT INTO shared_secrets (id, secret_value, passphrase_salt, passphrase_hash, expires_on) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	resource, err := statement.Exec(id, value, passphraseSalt, passphraseHash, expiresOn)
+	if err != nil {
+		return
+	}
+
+	rowCount, err := resource.RowsAffected()
+	if err != nil {
+		return
+	} else if rowCount == 0 {
+		err = errors.New("rows affected: 0, expected: 1")
+		return
+	}
+
+	return
+}
+
+// FindSecret returns the unexpired secret with provided id
+func FindSecret(id string) (secret *Secret, err error) {
+	statement, err := db.Prepare("SELECT id, secret_value, passphrase_salt, passphrase_hash, expires_on FROM shared_secrets WHERE id = ? AND expires_on > ?")
+	if err != nil {
+		return
+	}
+	rows, err := statement.Query(id, time.Now())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		secret = new(Secret)
+		if err = rows.Scan(&secret.ID, &secret.Value, &secret.PassphraseSalt, &secret.PassphraseHash, &secret.ExpiresOn); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// DeleteSecret deletes a secret from the database, reporting whether it still existed
+func DeleteSecret(id string) (deleted bool, err error) {
+	statement, err := db.Prepare("DELETE FROM shared_secrets WHERE id = ?")
+	if err != nil {
+		return
+	}
+	resource, err := statement.Exec(id)
+	if err != nil {
+		return
+	}
+
+	rowCount, err := resource.RowsAffected()
+	if err != nil {
+		return
+	}
+	deleted = rowCount == 1
+	return
+}
+
+// CountSecretAttempt counts a passphrase attempt on the unexpired secret before the passphrase is checked,
+// reporting false once maxAttempts were counted; a right passphrase deletes the secret, so only failed attempts remain
+func CountSecretAttempt(id string, maxAttempts int) (counted bool, err error) {
+	statement, err := db.Prepare("UPDATE shared_secrets SET failed_attempts = failed_attempts + 1 WHERE id = ? AND failed_attempts < ? AND expires_on > ?")
+	if err != nil {
+		return
+	}
+	resource, err := statement.Exec(id, maxAttempts, time.Now())
+	if err != nil {
+		return
+	}
+
+	rowCount, err := resource.RowsAffected()
+	if err != nil {
+		return
+	}
+	counted = rowCount == 1
+	return
+}
+
+// DeleteExhaustedSecret deletes a secret with maxAttempts failed passphrase attempts, reporting whether it did
+func DeleteExhaustedSecret(id string, maxAttempts int) (deleted bool, err error) {
+	statement, err := db.Prepare("DELETE FROM shared_secrets WHERE id = ? AND failed_attempts >= ?")
+	if err != nil {
+		return
+	}
+	resource, err := statement.Exec(id, maxAttempts)
+	if err != nil {
+		return
+	}
+
+	rowCount, err := resource.RowsAffected()
+	if err != nil {
+		return
+	}
+	deleted = rowCount == 1
+	return
+}
+
+// DeleteExpiredSecrets deletes all secrets past their expiration time
+func DeleteExpiredSecrets() (count int64, err error) {
+	statement, err := db.Prepare("DELETE FROM shared_secrets WHERE expires_on <= ?")
+	if err != nil {
+		return
+	}
+	resource, err := statement.Exec(time.Now())
+	if err != nil {
+		return
+	}
+
+	count, err = resource.RowsAffected()
+	return
+}
+
+// CreateIssuedCertificate records a certificate issued by the CA stored as key caKeyID
+func CreateIssuedCertificate(caKeyID int, serialNumber, subject, certificate string, issuedOn, expiresOn time.Time) (err error) {
+	statement, err := db.Prepare("INSERT INTO issued_certificates (ca_key_id, serial_number, subject, certificate, issued_on, expires_on) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	resource, err := statement.Exec(caKeyID, serialNumber, subject, certificate, issuedOn, expiresOn)
+	if err != nil {
+		return
+	}
+
+	rowCount, err := resource.RowsAffected()
+	if err != nil {
+		return
+	} else if rowCount == 0 {
+		err = errors.New("rows affected: 0, expected: 1")
+		return
+	}
+
+	return
+}
+
+// FindIssuedCertificates returns all certificates issued by the CA stored as key caKeyID, newest first
+func FindIssuedCertificates(caKeyID int) (certificates []IssuedCertificate, err error) {
+	statement, err := db.Prepare("SELECT id, ca_key_id, serial_number, subject, certificate, issued_on, expires_on, revoked_on, revocation_reason FROM issued_certificates WHERE ca_key_id = ? ORDER BY issued_on DESC, id DESC")
+	if err != nil {
+		return
+	}
+	rows, err := statement.Query(caKeyID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	certificates = make([]IssuedCertificate, 0, 10)
+	for rows.Next() {
+		certificate := IssuedCertificate{}
+		var revokedOn sql.NullTime
+		if err = rows.Scan(&certificate.ID, &certificate.CAKeyID, &certificate.SerialNumber, &certificate.Subject, &certificate.Certificate, &certificate.IssuedOn, &certificate.ExpiresOn, &revokedOn, &certificate.RevocationReason); err != nil {
+			return
+		}
+		if revokedOn.Valid {
+			certificate.RevokedOn = &revokedOn.Time
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return
+}
+
+// RevokeIssuedCertificate marks a certificate as revoked, reporting whether an unrevoked certificate was found
+func RevokeIssuedCertificate(caKeyID int, serialNumber string, reason int, revokedOn time.Time) (revoked bool, err error) {
+	statement, err := db.Prepare("UPDATE issued_certificates SET revoked_on = ?, revocation_reason = ? WHERE ca_key_id = ? AND serial_number = ? AND revoked_on IS NULL")
+	if err != nil {
+		return
+	}
+	resource, err := statement.Exec(revokedOn, reason, caKeyID, serialNumber)
+	if err != nil {
+		return
+	}
+
+	rowCount, err := resource.RowsAffected()
+	if err != nil {
+		return
+	}
+	revoked = rowCount == 1
+	return
+}
+
 // ComputePasswordHash generates a password hash given password and salt
 func ComputePasswordHash(password, salt string) (result string, err error) {
 	result, err = hashing.GenerateHash(sha256.New(), password+salt)
 	return
 }
 
-func generatePasswordSalt() string {
+func generatePasswordSalt() (string, error) {
 	return keygen.GeneratePassword(9, 9, 3, 11)
 }
@@ -0,0 +1,235 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"../auth"
+	"../dbhelper"
+	"../keygen"
+)
+
+var (
+	errConvertAuth  = errors.New("convert: authentication required for stored keys")
+	errConvertKeyID = errors.New("convert: key not found or not convertible")
+)
+
+var privateKeyFormats = []string{"pkcs1", "sec1", "pkcs8", "jwk", "jwks", "openssh"}
+
+var publicKeyFormats = []string{"spki", "pkcs1", "jwk", "jwks", "openssh"}
+
+var symmetricKeyFormats = []string{"hex", "base64", "jwk"}
+
+// symmetricKeyTypes are the stored key types holding hex-encoded symmetric keys
+var symmetricKeyTypes = []string{"AES", "Blowfish", "Twofish"}
+
+// asymmetricKeyTypes are the stored key types holding PEM-encoded key pairs
+var asymmetricKeyTypes = []string{"RSA", "ECDSA", "X.509", "SSH"}
+
+var convertibleKeyTypes = append(append([]string{}, symmetricKeyTypes...), asymmetricKeyTypes...)
+
+// ConvertKey - POST /key/convert, optionally authenticated
+// Params:
+// - key : private, public or symmetric key to convert, asymmetric keys in any format accepted by /key/inspect
+// - keyID : the id of a stored RSA, ECDSA, X.509, SSH, AES, Blowfish or Twofish key, used instead of key
+//   so that the key does not need to be sent back to the server (requires authentication)
+// - inputFormat : pkcs1, sec1, pkcs8, spki, x509, openssh, authorized_keys or jwk for asymmetric keys, checked against
+//   the detected format (optional); hex or base64 for symmetric keys (required unless the key is a JWK of type oct)
+// - format : target format; pkcs1 (RSA only), sec1 (ECDSA only), pkcs8, jwk, jwks or openssh for private keys,
+//   which return the private and public key as /rsa/key does; spki, pkcs1 (RSA only), jwk, jwks or openssh
+//   (authorized_keys) for public keys; hex, base64 or jwk for symmetric keys
+// - inputPassphrase : passphrase of an encrypted PKCS #8 or OpenSSH private key (optional)
+// - passphrase : passphrase to encrypt the converted private key with, pkcs8 and openssh only (optional)
+// - kdf : scrypt or pbkdf2, the PBES2 key derivation function of encrypted pkcs8 keys (optional, defaults to scrypt)
+// Returns:
+// - converted key in the target format
+func ConvertKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	formatValues, ok := r.PostForm["format"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field format"))
+		return
+	}
+
+	inputFormat := r.PostForm.Get("inputFormat")
+	var value string
+	if keyIDValues, ok := r.PostForm["keyID"]; ok {
+		key, err := findStoredConvertibleKey(r, keyIDValues[0])
+		if err == errConvertAuth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		} else if err == errConvertKeyID {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid keyID"))
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("can not retrieve key: %v", err.Error())
+			return
+		}
+		value = key.Value
+		if containsString(symmetricKeyTypes, key.Type) {
+			inputFormat = "hex"
+		}
+	} else if keyValues, ok := r.PostForm["key"]; ok {
+		value = keyValues[0]
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+
+	incorrect := make([]string, 0, 4)
+	format := formatValues[0]
+	passphrase := r.PostForm.Get("passphrase")
+	kdf := keygen.PKCS8KDFs[0]
+	if kdfValues, ok := r.PostForm["kdf"]; ok {
+		kdf = kdfValues[0]
+		if !containsString(keygen.PKCS8KDFs, kdf) {
+			incorrect = append(incorrect, "kdf")
+		}
+	}
+
+	symmetricKey, privateKey, publicKey, detectedFormat, err := parseConvertibleKey([]byte(value), inputFormat, []byte(r.PostForm.Get("inputPassphrase")))
+	if keygen.IsPassphraseError(err) {
+		writeKeyError(w, err)
+		return
+	} else if err != nil {
+		incorrect = append(incorrect, "key")
+	} else if inputFormat != "" && inputFormat != strings.TrimSuffix(detectedFormat, "-der") {
+		incorrect = append(incorrect, "inputFormat")
+	}
+	if err == nil && !isConvertibleFormat(format, symmetricKey, privateKey, publicKey) {
+		incorrect = append(incorrect, "format")
+	}
+	if passphrase != "" && (privateKey == nil || (format != "pkcs8" && format != "openssh")) {
+		incorrect = append(incorrect, "passphrase")
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	var result []byte
+	switch {
+	case symmetricKey != nil:
+		result, err = keygen.EncodeSymmetricKey(symmetricKey, format)
+	case privateKey != nil && passphrase != "":
+		result, err = keygen.EncodeProtectedKeyPair(privateKey, format, []byte(passphrase), kdf)
+	case privateKey != nil:
+		result, err = keygen.EncodeKeyPair(privateKey, format)
+	default:
+		result, err = keygen.EncodePublicKey(publicKey, format)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not convert key to %v: %v", format, err.Error())
+		return
+	}
+	if format == "jwk" || format == "jwks" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(result)
+}
+
+// parseConvertibleKey reads a symmetric key for the hex and base64 input formats and JWKs of type oct,
+// otherwise a private key or, failing that, a public key
+func parseConvertibleKey(key []byte, inputFormat string, passphrase []byte) (symmetricKey []byte, privateKey crypto.Signer, publicKey crypto.PublicKey, format string, err error) {
+	trimmed := bytes.TrimSpace(key)
+	switch inputFormat {
+	case "hex":
+		symmetricKey, err = hex.DecodeString(string(trimmed))
+		return symmetricKey, nil, nil, inputFormat, nonEmpty(symmetricKey, err)
+	case "base64":
+		symmetricKey, err = base64.StdEncoding.DecodeString(string(trimmed))
+		return symmetricKey, nil, nil, inputFormat, nonEmpty(symmetricKey, err)
+	}
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		if jwk, err := keygen.ParseJSONWebKey(trimmed); err == nil {
+			if octKey, ok := jwk.([]byte); ok {
+				return octKey, nil, nil, "jwk", nil
+			}
+		}
+	}
+
+	if privateKey, format, _, err = keygen.ParsePrivateKey(key, passphrase); err == nil || keygen.IsPassphraseError(err) {
+		return nil, privateKey, nil, format, err
+	}
+	publicKey, format, err = parsePublicKey(key)
+	return nil, nil, publicKey, format, err
+}
+
+// isConvertibleFormat checks whether the key can be encoded in the target format
+func isConvertibleFormat(format string, symmetricKey []byte, privateKey crypto.Signer, publicKey crypto.PublicKey) bool {
+	if symmetricKey != nil {
+		return containsString(symmetricKeyFormats, format)
+	}
+	formats := publicKeyFormats
+	if privateKey != nil {
+		formats, publicKey = privateKeyFormats, privateKey.Public()
+	}
+	if !containsString(formats, format) {
+		return false
+	}
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return format != "sec1"
+	case *ecdsa.PublicKey:
+		return format != "pkcs1"
+	case ed25519.PublicKey:
+		// Ed25519 keys have no PKCS #1 or SEC 1 encoding
+		return format != "pkcs1" && format != "sec1"
+	}
+	return false
+}
+
+// findStoredConvertibleKey returns the key with the given id if it belongs to the authenticated user and is convertible
+func findStoredConvertibleKey(r *http.Request, keyID string) (*dbhelper.Key, error) {
+	userID, ok := auth.UserID(r)
+	if !ok {
+		return nil, errConvertAuth
+	}
+
+	id, err := strconv.Atoi(keyID)
+	if err != nil {
+		return nil, errConvertKeyID
+	}
+	key, err := dbhelper.FindOwnedKey(id, userID, convertibleKeyTypes...)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errConvertKeyID
+	}
+	return key, nil
+}
+
+// nonEmpty rejects empty decoded keys
+func nonEmpty(key []byte, err error) error {
+	if err == nil && len(key) == 0 {
+		return errors.New("empty key")
+	}
+	return err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package encrypt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"../keygen"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConvertKeyPrivateFormats(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	for _, format := range []string{"pkcs8", "jwk", "openssh"} {
+		rr := postForm(t, ConvertKey, "/key/convert", url.Values{"key": {pkcs1}, "inputFormat": {"pkcs1"}, "format": {format}})
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("ConvertKey returned incorrect status code for %v: got: %v, expected: %v", format, status, http.StatusOK)
+		}
+		converted, detectedFormat, _, err := keygen.ParsePrivateKey(rr.Body.Bytes(), nil)
+		if err != nil || detectedFormat != format || !key.Equal(converted) {
+			t.Errorf("ConvertKey returned incorrect %v key: %v", format, rr.Body.String())
+		}
+	}
+}
+
+func TestConvertKeyOpenSSHToPKCS8(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := postForm(t, ConvertKey, "/key/convert", url.Values{"key": {string(pem.EncodeToMemory(block))}, "format": {"pkcs8"}})
+	privateBlock, rest := pem.Decode(rr.Body.Bytes())
+	if privateBlock == nil || privateBlock.Type != "PRIVATE KEY" {
+		t.Fatalf("ConvertKey returned incorrect PKCS #8 key: %v", rr.Body.String())
+	}
+	converted, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	if err != nil || !key.Equal(converted) {
+		t.Error("ConvertKey returned a different key")
+	}
+	if publicBlock, _ := pem.Decode(rest); publicBlock == nil || publicBlock.Type != "PUBLIC KEY" {
+		t.Errorf("ConvertKey returned incorrect public key: %v", string(rest))
+	}
+}
+
+func TestConvertKeyPublic(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spki, err := keygen.EncodePublicKey(key.Public(), "spki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := postForm(t, ConvertKey, "/key/convert", url.Values{"key": {string(spki)}, "format": {"openssh"}})
+	if body := rr.Body.String(); body != string(ssh.MarshalAuthorizedKey(sshKey)) {
+		t.Errorf("ConvertKey returned incorrect authorized_keys line: %v", body)
+	}
+	rr = postForm(t, ConvertKey, "/key/convert", url.Values{"key": {rr.Body.String()}, "format": {"pkcs1"}})
+	if block, _ := pem.Decode(rr.Body.Bytes()); block == nil || block.Type != "RSA PUBLIC KEY" {
+		t.Errorf("ConvertKey returned incorrect PKCS #1 public key: %v", rr.Body.String())
+	}
+}
+
+func TestConvertKeySymmetric(t *testing.T) {
+	cases := []struct {
+		payload  url.Values
+		expected string
+	}{
+		{url.Values{"key": {"000102030405060708090a0b0c0d0e0f"}, "inputFormat": {"hex"}, "format": {"base64"}}, "AAECAwQFBgcICQoLDA0ODw=="},
+		{url.Values{"key": {"AAECAwQFBgcICQoLDA0ODw=="}, "inputFormat": {"base64"}, "format": {"jwk"}}, `{"kty":"oct","k":"AAECAwQFBgcICQoLDA0ODw"}`},
+		{url.Values{"key": {`{"kty":"oct","k":"AAECAwQFBgcICQoLDA0ODw"}`}, "format": {"hex"}}, "000102030405060708090a0b0c0d0e0f"},
+	}
+	for _, c := range cases {
+		rr := postForm(t, ConvertKey, "/key/convert", c.payload)
+		if body := rr.Body.String(); rr.Code != http.StatusOK || body != c.expected {
+			t.Errorf("ConvertKey returned incorrect key: got: %v %v, expected: %v", rr.Code, body, c.expected)
+		}
+	}
+}
+
+func TestConvertKeyPassphrase(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := keygen.EncodeKeyPair(key, "pkcs8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kdf := range []string{"scrypt", "pbkdf2"} {
+		payload := url.Values{"key": {string(pkcs8)}, "format": {"pkcs8"}, "passphrase": {"correct horse"}, "kdf": {kdf}}
+		rr := postForm(t, ConvertKey, "/key/convert", payload)
+		if block, _ := pem.Decode(rr.Body.Bytes()); block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+			t.Errorf("ConvertKey returned incorrect encrypted %v key: %v", kdf, rr.Body.String())
+		}
+	}
+
+	rr := postForm(t, ConvertKey, "/key/convert", url.Values{"key": {string(pkcs8)}, "format": {"openssh"}, "passphrase": {"correct horse"}})
+	if _, err := ssh.ParseRawPrivateKeyWithPassphrase(rr.Body.Bytes(), []byte("correct horse")); err != nil {
+		t.Errorf("ConvertKey returned incorrect encrypted OpenSSH key: %v", err)
+	}
+}
+
+func TestConvertKeyIncorrectFields(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	cases := map[string]url.Values{
+		"incorrect fields: inputFormat, format, passphrase": {"key": {pkcs1}, "inputFormat": {"sec1"}, "format": {"sec1"}, "passphrase": {"secret"}},
+		"incorrect fields: kdf, key":                        {"key": {"not a key"}, "format": {"pkcs8"}, "kdf": {"md5"}},
+		"incorrect fields: format":                          {"key": {"00ff"}, "inputFormat": {"hex"}, "format": {"pkcs8"}},
+		"missing field format":                              {"key": {pkcs1}},
+	}
+	for expected, payload := range cases {
+		rr := postForm(t, ConvertKey, "/key/convert", payload)
+		if rr.Code != http.StatusBadRequest || rr.Body.String() != expected {
+			t.Errorf("ConvertKey returned unexpected response: got: %v %v, expected: %v", rr.Code, rr.Body.String(), expected)
+		}
+	}
+
+	rr := postForm(t, ConvertKey, "/key/convert", url.Values{"keyID": {"1"}, "format": {"pkcs8"}})
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("ConvertKey returned incorrect status code for a stored key: got: %v, expected: %v", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,259 @@
+package encrypt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"../keygen"
+)
+
+// ECDSASign - POST /ecdsa/sign
+// Params:
+// - key : the private key to sign with, in PKCS #8 or SEC 1 PEM format, e.g. generated by /ecdsa/key
+// - passphrase : the passphrase of an encrypted PKCS #8 or OpenSSH private key (optional)
+// - data : non-empty string to be signed
+// - hash : sha-256, sha-384 or sha-512 (optional, defaults to sha-256 for P-256, sha-384 for P-384 and sha-512 for P-521)
+// - encoding : der (ASN.1 DER sequence of r and s) or raw (r || s, each padded to the curve size) (optional, defaults to der)
+// Returns:
+// - signature, encoded in base64
+func ECDSASign(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	missing := make([]string, 0, 2)
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		missing = append(missing, "key")
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		missing = append(missing, "data")
+	}
+	if len(missing) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing fields: " + strings.Join(missing, ", ")))
+		return
+	}
+
+	incorrect := make([]string, 0, 4)
+	key, err := parseECDSAPrivateKey([]byte(keyValues[0]), []byte(r.PostForm.Get("passphrase")))
+	if keygen.IsPassphraseError(err) {
+		incorrect = append(incorrect, "passphrase")
+	} else if err != nil {
+		incorrect = append(incorrect, "key")
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		incorrect = append(incorrect, "data")
+	}
+	var curve elliptic.Curve
+	if key != nil {
+		curve = key.Curve
+	}
+	hash, encoding, incorrectOptions := parseSignatureOptions(r, curve)
+	incorrect = append(incorrect, incorrectOptions...)
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	signature, err := ecdsaSign(key, hash, []byte(data), encoding)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("ECDSASign can not sign data: %v", err.Error())
+		return
+	}
+	w.Write([]byte(base64.StdEncoding.EncodeToString(signature)))
+}
+
+// ECDSAVerify - POST /ecdsa/verify
+// Params:
+// - key : the public key in PKIX PEM format; a private key, or a stored key pair, is accepted as well
+// - data : the signed string
+// - signature : base64-encoded signature
+// - hash : sha-256, sha-384 or sha-512 (optional, defaults as for /ecdsa/sign)
+// - encoding : der or raw (optional, defaults to der)
+// Returns:
+// - verification result in JSON format:
+//   "valid": boolean
+func ECDSAVerify(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	missing := make([]string, 0, 3)
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		missing = append(missing, "key")
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		missing = append(missing, "data")
+	}
+	signatureValues, ok := r.PostForm["signature"]
+	if !ok {
+		missing = append(missing, "signature")
+	}
+	if len(missing) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing fields: " + strings.Join(missing, ", ")))
+		return
+	}
+
+	incorrect := make([]string, 0, 4)
+	key, err := parseECDSAPublicKey([]byte(keyValues[0]))
+	if err != nil {
+		incorrect = append(incorrect, "key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatureValues[0])
+	if err != nil || len(signature) == 0 {
+		incorrect = append(incorrect, "signature")
+	}
+	var curve elliptic.Curve
+	if key != nil {
+		curve = key.Curve
+	}
+	hash, encoding, incorrectOptions := parseSignatureOptions(r, curve)
+	incorrect = append(incorrect, incorrectOptions...)
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	result := struct {
+		Valid bool `json:"valid"`
+	}{
+		Valid: ecdsaVerify(key, hash, []byte(dataValues[0]), signature, encoding),
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize verification result to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// parseSignatureOptions reads the hash and encoding params, the default hash matches the curve size
+func parseSignatureOptions(r *http.Request, curve elliptic.Curve) (hash crypto.Hash, encoding string, incorrect []string) {
+	hash = crypto.SHA256
+	if curve != nil {
+		switch curve.Params().BitSize {
+		case 384:
+			hash = crypto.SHA384
+		case 521:
+			hash = crypto.SHA512
+		}
+	}
+	if hashValues, ok := r.PostForm["hash"]; ok {
+		switch hashValues[0] {
+		case "sha-256":
+			hash = crypto.SHA256
+		case "sha-384":
+			hash = crypto.SHA384
+		case "sha-512":
+			hash = crypto.SHA512
+		default:
+			incorrect = append(incorrect, "hash")
+		}
+	}
+
+	encoding = "der"
+	if encodingValues, ok := r.PostForm["encoding"]; ok {
+		encoding = encodingValues[0]
+		if encoding != "der" && encoding != "raw" {
+			incorrect = append(incorrect, "encoding")
+		}
+	}
+	return
+}
+
+// parseECDSAPrivateKey returns the first ECDSA private key of the input, in any format supported by parsePrivateKey
+func parseECDSAPrivateKey(key, passphrase []byte) (*ecdsa.PrivateKey, error) {
+	pk, _, _, err := keygen.ParsePrivateKey(key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := pk.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+// parseECDSAPublicKey returns the first ECDSA public key of the PEM input, or the public part of its first private key
+func parseECDSAPublicKey(key []byte) (*ecdsa.PublicKey, error) {
+	for rest := key; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "PUBLIC KEY" {
+			pubk, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			ecdsaKey, ok := pubk.(*ecdsa.PublicKey)
+			if !ok {
+				return nil, errors.New("not an ECDSA key")
+			}
+			return ecdsaKey, nil
+		}
+	}
+
+	pk, err := parseECDSAPrivateKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &pk.PublicKey, nil
+}
+
+func ecdsaSign(key *ecdsa.PrivateKey, hash crypto.Hash, data []byte, encoding string) ([]byte, error) {
+	hasher := hash.New()
+	hasher.Write(data)
+	digest := hasher.Sum(nil)
+
+	if encoding == "der" {
+		return ecdsa.SignASN1(rand.Reader, key, digest)
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		return nil, err
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature, nil
+}
+
+func ecdsaVerify(key *ecdsa.PublicKey, hash crypto.Hash, data, signature []byte, encoding string) bool {
+	hasher := hash.New()
+	hasher.Write(data)
+	digest := hasher.Sum(nil)
+
+	if encoding == "der" {
+		return ecdsa.VerifyASN1(key, digest, signature)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	if len(signature) != 2*size {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	return ecdsa.Verify(key, digest, r, s)
+}
@@ -0,0 +1,141 @@
+package encrypt
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"../keygen"
+)
+
+func TestECDSA(t *testing.T) {
+	cases := []struct {
+		curve, format, encoding string
+		rawLength               int
+	}{
+		{"P-256", "pkcs8", "der", 64},
+		{"P-256", "sec1", "raw", 64},
+		{"P-384", "pkcs8", "raw", 96},
+		{"P-521", "sec1", "der", 132},
+		{"P-521", "pkcs8", "raw", 132},
+	}
+	for _, c := range cases {
+		keys := generateECDSAKeyPair(t, c.curve, c.format)
+		keySplit := strings.Split(keys, "-----\n-----")
+		if len(keySplit) != 2 {
+			t.Fatal("Generated key can not be split into private and public key parts")
+		}
+		privateKey := keySplit[0] + "-----"
+		publicKey := "-----" + keySplit[1]
+
+		data := "sample text to sign"
+		payload := url.Values{"key": {privateKey}, "data": {data}, "encoding": {c.encoding}}
+		rr := postForm(t, ECDSASign, "/ecdsa/sign", payload)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("ECDSASign returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+		}
+		signature := rr.Body.String()
+		if c.encoding == "raw" {
+			if decoded, _ := base64.StdEncoding.DecodeString(signature); len(decoded) != c.rawLength {
+				t.Errorf("ECDSASign returned raw %v signature of incorrect length: got: %v, expected: %v", c.curve, len(decoded), c.rawLength)
+			}
+		}
+
+		// the stored key pair is accepted for verification as well as the public key
+		for _, key := range []string{publicKey, keys} {
+			payload = url.Values{"key": {key}, "data": {data}, "signature": {signature}, "encoding": {c.encoding}}
+			rr = postForm(t, ECDSAVerify, "/ecdsa/verify", payload)
+			if body := rr.Body.String(); body != `{"valid":true}` {
+				t.Errorf("ECDSAVerify did not accept %v %v signature: %v", c.curve, c.encoding, body)
+			}
+		}
+
+		payload = url.Values{"key": {publicKey}, "data": {data + "."}, "signature": {signature}, "encoding": {c.encoding}}
+		rr = postForm(t, ECDSAVerify, "/ecdsa/verify", payload)
+		if body := rr.Body.String(); body != `{"valid":false}` {
+			t.Errorf("ECDSAVerify accepted %v %v signature of modified data: %v", c.curve, c.encoding, body)
+		}
+	}
+}
+
+func TestECDSAHashMismatch(t *testing.T) {
+	keys := generateECDSAKeyPair(t, "P-256", "pkcs8")
+
+	payload := url.Values{"key": {keys}, "data": {"sample"}, "hash": {"sha-512"}}
+	rr := postForm(t, ECDSASign, "/ecdsa/sign", payload)
+	signature := rr.Body.String()
+
+	payload = url.Values{"key": {keys}, "data": {"sample"}, "signature": {signature}}
+	rr = postForm(t, ECDSAVerify, "/ecdsa/verify", payload)
+	if body := rr.Body.String(); body != `{"valid":false}` {
+		t.Errorf("ECDSAVerify accepted signature with a different hash: %v", body)
+	}
+}
+
+func TestECDSASignRSAKey(t *testing.T) {
+	req, err := http.NewRequest("GET", "/rsa/key?keyLength=1024", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(keygen.RSAKey).ServeHTTP(rr, req)
+
+	payload := url.Values{"key": {rr.Body.String()}, "data": {"sample"}, "encoding": {"p1363"}}
+	rr = postForm(t, ECDSASign, "/ecdsa/sign", payload)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("ECDSASign returned incorrect status code: got: %v, expected: %v", status, http.StatusBadRequest)
+	}
+	expectedBody := "incorrect fields: key, encoding"
+	if body := rr.Body.String(); body != expectedBody {
+		t.Errorf("ECDSASign returned incorrect error message: got: %v, expected: %v", body, expectedBody)
+	}
+}
+
+func generateECDSAKeyPair(t *testing.T, curve, format string) string {
+	req, err := http.NewRequest("GET", "/ecdsa/key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := req.URL.Query()
+	query.Add("curve", curve)
+	query.Add("format", format)
+	req.URL.RawQuery = query.Encode()
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(keygen.ECDSAKey)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Key generation returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	return rr.Body.String()
+}
+
+func postForm(t *testing.T, handlerFunc http.HandlerFunc, path string, payload url.Values) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", path, strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handlerFunc.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestECDSASignEncryptedKey(t *testing.T) {
+	rr := postForm(t, keygen.ECDSAKey, "/ecdsa/key", url.Values{"curve": {"P-256"}, "format": {"openssh"}, "passphrase": {"correct horse"}})
+	keys := rr.Body.String()
+
+	rr = postForm(t, ECDSASign, "/ecdsa/sign", url.Values{"key": {keys}, "data": {"sample"}})
+	if body := rr.Body.String(); body != "incorrect fields: passphrase" {
+		t.Errorf("ECDSASign returned incorrect error message: %v", body)
+	}
+	rr = postForm(t, ECDSASign, "/ecdsa/sign", url.Values{"key": {keys}, "passphrase": {"correct horse"}, "data": {"sample"}})
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("ECDSASign returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+}
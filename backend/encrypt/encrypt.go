@@ -4,20 +4,24 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/des"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/pem"
 	"errors"
 	"io"
 	"log"
 	"net/http"
 
+	"../keygen"
+	"github.com/dgryski/go-camellia"
+	"github.com/tjfoc/gmsm/sm4"
 	"golang.org/x/crypto/blowfish"
+	"golang.org/x/crypto/cast5"
 	"golang.org/x/crypto/twofish"
+	"golang.org/x/crypto/xtea"
 )
 
 // RSAEncrypt - POST /rsa/encrypt
@@ -68,6 +72,7 @@ func RSAEncrypt(w http.ResponseWriter, r *http.Request) {
 // RSADecrypt - POST /rsa/decrypt
 // Params:
 // - key : the private key to use for decryption
+// - passphrase : the passphrase of an encrypted PKCS #8 or OpenSSH private key (optional)
 // - data : non-empty base64 string to be decrypted
 // Returns:
 // - decrypted plain text
@@ -87,10 +92,9 @@ func RSADecrypt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	key, _, err := parseRSAPrivateKey([]byte(keyValues[0]))
+	key, _, err := parseRSAPrivateKey([]byte(keyValues[0]), []byte(r.PostForm.Get("passphrase")))
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("invalid key"))
+		writeKeyError(w, err)
 		return
 	}
 	data := dataValues[0]
@@ -380,32 +384,496 @@ func TwofishDecrypt(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(decryptedContent))
 }
 
+// TripleDESEncrypt - POST /3des/encrypt
+// Params:
+// - key : the key to use for encryption, generated by /3des/key or respecting its constraints and format
+// - data : non-empty string to be encrypted
+// Returns:
+// - encrypted text, encoded in base64
+// 3DES is a legacy cipher, so the response is marked as deprecated.
+func TripleDESEncrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	encryptedContent, err := tripleDESEncrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("TripleDESEncrypt can not encrypt data: %v", err.Error())
+		return
+	}
+
+	keygen.MarkDeprecated(w, "3DES")
+	w.Write([]byte(encryptedContent))
+}
+
+// TripleDESDecrypt - POST /3des/decrypt
+// Params:
+// - key : the key to use for decryption
+// - data : non-empty base64 string to be decrypted
+// Returns:
+// - decrypted plain text
+// 3DES is a legacy cipher, so the response is marked as deprecated.
+func TripleDESDecrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	decryptedContent, err := tripleDESDecrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("TripleDESDecrypt can not decrypt data: %v", err.Error())
+		return
+	}
+
+	keygen.MarkDeprecated(w, "3DES")
+	w.Write([]byte(decryptedContent))
+}
+
+// CAST5Encrypt - POST /cast5/encrypt
+// Params:
+// - key : the key to use for encryption, generated by /cast5/key or respecting its constraints and format
+// - data : non-empty string to be encrypted
+// Returns:
+// - encrypted text, encoded in base64
+// CAST5 is a legacy cipher, so the response is marked as deprecated.
+func CAST5Encrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	encryptedContent, err := cast5Encrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("CAST5Encrypt can not encrypt data: %v", err.Error())
+		return
+	}
+
+	keygen.MarkDeprecated(w, "CAST5")
+	w.Write([]byte(encryptedContent))
+}
+
+// CAST5Decrypt - POST /cast5/decrypt
+// Params:
+// - key : the key to use for decryption
+// - data : non-empty base64 string to be decrypted
+// Returns:
+// - decrypted plain text
+// CAST5 is a legacy cipher, so the response is marked as deprecated.
+func CAST5Decrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	decryptedContent, err := cast5Decrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("CAST5Decrypt can not decrypt data: %v", err.Error())
+		return
+	}
+
+	keygen.MarkDeprecated(w, "CAST5")
+	w.Write([]byte(decryptedContent))
+}
+
+// CamelliaEncrypt - POST /camellia/encrypt
+// Params:
+// - key : the key to use for encryption, generated by /camellia/key or respecting its constraints and format
+// - data : non-empty string to be encrypted
+// Returns:
+// - encrypted text, encoded in base64
+func CamelliaEncrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	encryptedContent, err := camelliaEncrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("CamelliaEncrypt can not encrypt data: %v", err.Error())
+		return
+	}
+
+	w.Write([]byte(encryptedContent))
+}
+
+// CamelliaDecrypt - POST /camellia/decrypt
+// Params:
+// - key : the key to use for decryption
+// - data : non-empty base64 string to be decrypted
+// Returns:
+// - decrypted plain text
+func CamelliaDecrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	decryptedContent, err := camelliaDecrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("CamelliaDecrypt can not decrypt data: %v", err.Error())
+		return
+	}
+
+	w.Write([]byte(decryptedContent))
+}
+
+// SM4Encrypt - POST /sm4/encrypt
+// Params:
+// - key : the key to use for encryption, generated by /sm4/key or respecting its constraints and format
+// - data : non-empty string to be encrypted
+// Returns:
+// - encrypted text, encoded in base64
+func SM4Encrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	encryptedContent, err := sm4Encrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("SM4Encrypt can not encrypt data: %v", err.Error())
+		return
+	}
+
+	w.Write([]byte(encryptedContent))
+}
+
+// SM4Decrypt - POST /sm4/decrypt
+// Params:
+// - key : the key to use for decryption
+// - data : non-empty base64 string to be decrypted
+// Returns:
+// - decrypted plain text
+func SM4Decrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	decryptedContent, err := sm4Decrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("SM4Decrypt can not decrypt data: %v", err.Error())
+		return
+	}
+
+	w.Write([]byte(decryptedContent))
+}
+
+// XTEAEncrypt - POST /xtea/encrypt
+// Params:
+// - key : the key to use for encryption, generated by /xtea/key or respecting its constraints and format
+// - data : non-empty string to be encrypted
+// Returns:
+// - encrypted text, encoded in base64
+// XTEA is a legacy cipher, so the response is marked as deprecated.
+func XTEAEncrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	encryptedContent, err := xteaEncrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("XTEAEncrypt can not encrypt data: %v", err.Error())
+		return
+	}
+
+	keygen.MarkDeprecated(w, "XTEA")
+	w.Write([]byte(encryptedContent))
+}
+
+// XTEADecrypt - POST /xtea/decrypt
+// Params:
+// - key : the key to use for decryption
+// - data : non-empty base64 string to be decrypted
+// Returns:
+// - decrypted plain text
+// XTEA is a legacy cipher, so the response is marked as deprecated.
+func XTEADecrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	decryptedContent, err := xteaDecrypt(key, data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("XTEADecrypt can not decrypt data: %v", err.Error())
+		return
+	}
+
+	keygen.MarkDeprecated(w, "XTEA")
+	w.Write([]byte(decryptedContent))
+}
+
 func parseKey(key string) ([]byte, error) {
 	return hex.DecodeString(key)
 }
 
-func parseRSAPrivateKey(key []byte) (*rsa.PrivateKey, []byte, error) {
-	k, rest := pem.Decode(key)
-	if k == nil {
-		return nil, nil, errors.New("can not decode key")
-	}
-	pk, err := x509.ParsePKCS1PrivateKey(k.Bytes)
+// parseRSAPrivateKey reads the first RSA private key of the input, in any format supported by parsePrivateKey
+func parseRSAPrivateKey(key, passphrase []byte) (*rsa.PrivateKey, []byte, error) {
+	pk, _, rest, err := keygen.ParsePrivateKey(key, passphrase)
 	if err != nil {
 		return nil, nil, err
 	}
-	return pk, rest, nil
+	rsaKey, ok := pk.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("not an RSA key")
+	}
+	return rsaKey, rest, nil
 }
 
+// parseRSAPublicKey reads the first RSA public key of the input, in any format supported by parsePublicKey
 func parseRSAPublicKey(key []byte) (*rsa.PublicKey, error) {
-	k, _ := pem.Decode(key)
-	if k == nil {
-		return nil, errors.New("can not decode key")
-	}
-	pubk, err := x509.ParsePKCS1PublicKey(k.Bytes)
+	pubk, _, err := parsePublicKey(key)
 	if err != nil {
 		return nil, err
 	}
-	return pubk, nil
+	rsaKey, ok := pubk.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return rsaKey, nil
 }
 
 // https://github.com/brainattica/Golang-RSA-sample/blob/master/rsa_sample.go
@@ -568,3 +1036,126 @@ func twofishDecrypt(key []byte, data string) (string, error) {
 	cipherText = bytes.TrimRight(cipherText, "\x00") // remove any added padding
 	return string(cipherText), nil
 }
+
+func tripleDESEncrypt(key []byte, data string) (string, error) {
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcEncrypt(block, data)
+}
+
+func tripleDESDecrypt(key []byte, data string) (string, error) {
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcDecrypt(block, data)
+}
+
+func cast5Encrypt(key []byte, data string) (string, error) {
+	block, err := cast5.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcEncrypt(block, data)
+}
+
+func cast5Decrypt(key []byte, data string) (string, error) {
+	block, err := cast5.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcDecrypt(block, data)
+}
+
+func camelliaEncrypt(key []byte, data string) (string, error) {
+	block, err := camellia.New(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcEncrypt(block, data)
+}
+
+func camelliaDecrypt(key []byte, data string) (string, error) {
+	block, err := camellia.New(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcDecrypt(block, data)
+}
+
+func sm4Encrypt(key []byte, data string) (string, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcEncrypt(block, data)
+}
+
+func sm4Decrypt(key []byte, data string) (string, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcDecrypt(block, data)
+}
+
+func xteaEncrypt(key []byte, data string) (string, error) {
+	block, err := xtea.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcEncrypt(block, data)
+}
+
+func xteaDecrypt(key []byte, data string) (string, error) {
+	block, err := xtea.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	return cbcDecrypt(block, data)
+}
+
+// cbcEncrypt zero-pads the data and encrypts it in CBC mode under a random IV, which is prepended to the result
+func cbcEncrypt(block cipher.Block, data string) (string, error) {
+	blockSize := block.BlockSize()
+	dataBytes := []byte(data)
+
+	// pad data if needed
+	if remainder := len(dataBytes) % blockSize; remainder != 0 {
+		dataBytes = append(dataBytes, make([]byte, blockSize-remainder)...)
+	}
+
+	cipherText := make([]byte, blockSize+len(dataBytes))
+	iv := cipherText[:blockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	stream := cipher.NewCBCEncrypter(block, iv)
+	stream.CryptBlocks(cipherText[blockSize:], dataBytes)
+
+	return base64.StdEncoding.EncodeToString(cipherText), nil
+}
+
+func cbcDecrypt(block cipher.Block, data string) (string, error) {
+	cipherText, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+
+	blockSize := block.BlockSize()
+	if len(cipherText) < blockSize {
+		return "", errors.New("ciphertext block size is too short")
+	}
+	iv := cipherText[:blockSize]
+	cipherText = cipherText[blockSize:]
+	if len(cipherText)%blockSize != 0 {
+		return "", errors.New("ciphertext is not a multiple of the block size")
+	}
+	stream := cipher.NewCBCDecrypter(block, iv)
+	stream.CryptBlocks(cipherText, cipherText)
+
+	cipherText = bytes.TrimRight(cipherText, "\x00") // remove any added padding
+	return string(cipherText), nil
+}
@@ -0,0 +1,212 @@
+package encrypt
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/capitalone/fpe/ff1"
+	"github.com/capitalone/fpe/ff3"
+)
+
+// digits used by math/big for radixes up to 62; custom alphabets are mapped onto them
+const fpeDigits = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+const ff1MaxTweakLength = 256
+
+const ff31TweakLength = 7
+
+var errFPEAlphabet = errors.New("fpe: data contains characters outside of the alphabet")
+
+type fpeCipher interface {
+	Encrypt(string) (string, error)
+	Decrypt(string) (string, error)
+}
+
+// FF1Encrypt - POST /ff1/encrypt
+// Params:
+// - key : the key to use for encryption, generated by /aes/key or respecting its constraints and format
+// - data : non-empty string consisting only of alphabet characters
+// - radix : integer between 2 and 62 (optional, defaults to the alphabet length or 10)
+// - alphabet : string of distinct characters, one per digit (optional, defaults to the first radix characters of 0-9, a-z, A-Z)
+// - tweak : hex-encoded tweak of up to 256 bytes (optional, defaults to empty)
+// Returns:
+// - encrypted text of the same length and alphabet as data
+func FF1Encrypt(w http.ResponseWriter, r *http.Request) {
+	fpeHandler(w, r, newFF1Cipher, true)
+}
+
+// FF1Decrypt - POST /ff1/decrypt
+// Params:
+// - key, radix, alphabet, tweak : the parameters used for encryption, see /ff1/encrypt
+// - data : non-empty string consisting only of alphabet characters
+// Returns:
+// - decrypted text
+func FF1Decrypt(w http.ResponseWriter, r *http.Request) {
+	fpeHandler(w, r, newFF1Cipher, false)
+}
+
+// FF31Encrypt - POST /ff3-1/encrypt
+// Params:
+// - key : the key to use for encryption, generated by /aes/key or respecting its constraints and format
+// - data : non-empty string consisting only of alphabet characters
+// - radix : integer between 2 and 62 (optional, defaults to the alphabet length or 10)
+// - alphabet : string of distinct characters, one per digit (optional, defaults to the first radix characters of 0-9, a-z, A-Z)
+// - tweak : hex-encoded 56-bit tweak
+// Returns:
+// - encrypted text of the same length and alphabet as data
+func FF31Encrypt(w http.ResponseWriter, r *http.Request) {
+	fpeHandler(w, r, newFF31Cipher, true)
+}
+
+// FF31Decrypt - POST /ff3-1/decrypt
+// Params:
+// - key, radix, alphabet, tweak : the parameters used for encryption, see /ff3-1/encrypt
+// - data : non-empty string consisting only of alphabet characters
+// Returns:
+// - decrypted text
+func FF31Decrypt(w http.ResponseWriter, r *http.Request) {
+	fpeHandler(w, r, newFF31Cipher, false)
+}
+
+func fpeHandler(w http.ResponseWriter, r *http.Request, newCipher func(int, []byte, []byte) (fpeCipher, error), encrypt bool) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	incorrect := make([]string, 0, 5)
+	key, err := parseKey(keyValues[0])
+	if err != nil || !isAESKeyLength(len(key)) {
+		incorrect = append(incorrect, "key")
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		incorrect = append(incorrect, "data")
+	}
+	alphabet, err := parseAlphabet(r.PostForm.Get("radix"), r.PostForm.Get("alphabet"))
+	if err != nil {
+		incorrect = append(incorrect, "radix", "alphabet")
+	}
+	tweak, err := hex.DecodeString(r.PostForm.Get("tweak"))
+	if err != nil {
+		incorrect = append(incorrect, "tweak")
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	c, err := newCipher(len(alphabet), key, tweak)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid parameters: " + err.Error()))
+		return
+	}
+
+	result, err := fpeTransform(c, alphabet, data, encrypt)
+	if err != nil {
+		// the ciphers reject inputs which are too short or too long for the radix
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data: " + err.Error()))
+		return
+	}
+
+	w.Write([]byte(result))
+}
+
+// parseAlphabet resolves the radix and alphabet fields into the list of digit characters
+func parseAlphabet(radixValue, alphabetValue string) ([]rune, error) {
+	if alphabetValue != "" {
+		alphabet := []rune(alphabetValue)
+		seen := make(map[rune]bool, len(alphabet))
+		for _, c := range alphabet {
+			if seen[c] {
+				return nil, errors.New("fpe: alphabet characters are not distinct")
+			}
+			seen[c] = true
+		}
+		if radixValue != "" && radixValue != strconv.Itoa(len(alphabet)) {
+			return nil, errors.New("fpe: radix does not match the alphabet length")
+		}
+		if len(alphabet) < 2 || len(alphabet) > len(fpeDigits) {
+			return nil, errors.New("fpe: unsupported alphabet length")
+		}
+		return alphabet, nil
+	}
+
+	radix := 10
+	if radixValue != "" {
+		var err error
+		if radix, err = strconv.Atoi(radixValue); err != nil {
+			return nil, err
+		}
+	}
+	if radix < 2 || radix > len(fpeDigits) {
+		return nil, errors.New("fpe: unsupported radix")
+	}
+	return []rune(fpeDigits[:radix]), nil
+}
+
+// fpeTransform maps data from the alphabet onto the digits used by the cipher and the result back
+func fpeTransform(c fpeCipher, alphabet []rune, data string, encrypt bool) (string, error) {
+	indexes := make(map[rune]int, len(alphabet))
+	for i, a := range alphabet {
+		indexes[a] = i
+	}
+	input := make([]byte, 0, len(data))
+	for _, d := range data {
+		index, ok := indexes[d]
+		if !ok {
+			return "", errFPEAlphabet
+		}
+		input = append(input, fpeDigits[index])
+	}
+
+	var output string
+	var err error
+	if encrypt {
+		output, err = c.Encrypt(string(input))
+	} else {
+		output, err = c.Decrypt(string(input))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	result := make([]rune, 0, len(output))
+	for i := 0; i < len(output); i++ {
+		result = append(result, alphabet[strings.IndexByte(fpeDigits, output[i])])
+	}
+	return string(result), nil
+}
+
+func newFF1Cipher(radix int, key, tweak []byte) (fpeCipher, error) {
+	return ff1.NewCipher(radix, ff1MaxTweakLength, key, tweak)
+}
+
+// FF3-1 (NIST SP 800-38G Rev. 1) is FF3 with a 56-bit tweak, expanded into the 64-bit FF3 tweak
+func newFF31Cipher(radix int, key, tweak []byte) (fpeCipher, error) {
+	if len(tweak) != ff31TweakLength {
+		return nil, errors.New("fpe: tweak must be 56 bits long")
+	}
+	return ff3.NewCipher(radix, key, expandFF31Tweak(tweak))
+}
+
+// expandFF31Tweak splits the tweak T into TL = T[0..27] || 0^4 and TR = T[32..55] || T[28..31] || 0^4
+func expandFF31Tweak(tweak []byte) []byte {
+	return []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0, tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+}
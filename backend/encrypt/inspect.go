@@ -0,0 +1,247 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"../keygen"
+	"golang.org/x/crypto/ssh"
+)
+
+// InspectKey - POST /key/inspect
+// Params:
+// - key : RSA, ECDSA or Ed25519 key, private or public: PEM (PKCS #1, PKCS #8, SEC 1, SubjectPublicKeyInfo,
+//   X.509 certificate, OpenSSH), base64 or hex DER, JWK / JWKS, or an authorized_keys line
+// - passphrase : passphrase of an encrypted PKCS #8 or OpenSSH private key (optional)
+// - publicKey : public key in any of the formats above, to check whether it matches the key (optional)
+// Returns:
+// - key details in JSON format:
+//   "private": boolean,
+//   "format": string, pkcs1, pkcs8, sec1, spki or x509, with a -der suffix for DER input, jwk, openssh or authorized_keys,
+//   "algorithm": string, RSA, ECDSA or Ed25519,
+//   "bits": integer, the key length in bits,
+//   "curve": string, ECDSA only,
+//   "publicExponent": integer, RSA only,
+//   "fingerprints": { "spkiSHA256": string, base64 SHA-256 of the SubjectPublicKeyInfo, "sshSHA256": string,
+//   "sshMD5": string, "jwkThumbprint": string, RFC 7638 },
+//   "matchesPublicKey": boolean, only if publicKey is set,
+//   "warnings": [ string, ... ], e.g. for RSA keys shorter than 2048 bits
+func InspectKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+
+	var publicKey crypto.PublicKey
+	private := true
+	key, format, _, err := keygen.ParsePrivateKey([]byte(keyValues[0]), []byte(r.PostForm.Get("passphrase")))
+	if err == nil {
+		publicKey = key.Public()
+	} else if !keygen.IsPassphraseError(err) {
+		private = false
+		publicKey, format, err = parsePublicKey([]byte(keyValues[0]))
+	}
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("unsupported key type"))
+		return
+	}
+
+	var matches *bool
+	if publicKeyValues, ok := r.PostForm["publicKey"]; ok {
+		otherKey, _, err := parsePublicKey([]byte(publicKeyValues[0]))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid publicKey"))
+			return
+		}
+		equal := publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(otherKey)
+		matches = &equal
+	}
+
+	result := struct {
+		Private          bool              `json:"private"`
+		Format           string            `json:"format"`
+		Algorithm        string            `json:"algorithm"`
+		Bits             int               `json:"bits"`
+		Curve            string            `json:"curve,omitempty"`
+		PublicExponent   int               `json:"publicExponent,omitempty"`
+		Fingerprints     map[string]string `json:"fingerprints"`
+		MatchesPublicKey *bool             `json:"matchesPublicKey,omitempty"`
+		Warnings         []string          `json:"warnings"`
+	}{
+		Private:          private,
+		Format:           format,
+		MatchesPublicKey: matches,
+		Warnings:         []string{},
+	}
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		result.Algorithm, result.Bits, result.PublicExponent = "RSA", k.N.BitLen(), k.E
+		if result.Bits < 2048 {
+			result.Warnings = append(result.Warnings, "RSA keys shorter than 2048 bits are insecure")
+		}
+		if k.E < 65537 {
+			result.Warnings = append(result.Warnings, "small public exponent "+strconv.Itoa(k.E)+", 65537 is recommended")
+		}
+	case *ecdsa.PublicKey:
+		result.Algorithm, result.Bits, result.Curve = "ECDSA", k.Curve.Params().BitSize, k.Curve.Params().Name
+		if result.Bits < 256 {
+			result.Warnings = append(result.Warnings, result.Curve+" provides less than 128 bits of security")
+		}
+	case ed25519.PublicKey:
+		result.Algorithm, result.Bits = "Ed25519", 256
+	}
+	if result.Fingerprints, err = keyFingerprints(publicKey); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not compute key fingerprints: %v", err)
+		return
+	}
+
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize key details to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// keyFingerprints computes the SubjectPublicKeyInfo, OpenSSH and JWK fingerprints of the public key
+func keyFingerprints(publicKey crypto.PublicKey) (map[string]string, error) {
+	spki, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	spkiHash := sha256.Sum256(spki)
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := map[string]string{
+		"spkiSHA256": base64.StdEncoding.EncodeToString(spkiHash[:]),
+		"sshSHA256":  ssh.FingerprintSHA256(sshKey),
+		"sshMD5":     "MD5:" + ssh.FingerprintLegacyMD5(sshKey),
+	}
+	if jwk, err := keygen.NewJSONWebKey(publicKey); err == nil {
+		fingerprints["jwkThumbprint"] = jwk.Kid
+	}
+	return fingerprints, nil
+}
+
+// writeKeyError writes the bad request response for a key which can not be parsed
+func writeKeyError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	if keygen.IsPassphraseError(err) {
+		w.Write([]byte(err.Error()))
+	} else {
+		w.Write([]byte("invalid key"))
+	}
+}
+
+// parsePublicKey reads the first public key of the input, or the public part of its first private key, returning its format:
+// PEM (SubjectPublicKeyInfo, PKCS #1, X.509 certificate), base64 or hex DER of these, JWK or an authorized_keys line
+func parsePublicKey(key []byte) (crypto.PublicKey, string, error) {
+	trimmed := bytes.TrimSpace(key)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		jwk, err := keygen.ParseJSONWebKey(trimmed)
+		if err != nil {
+			return nil, "", err
+		}
+		if signer, ok := jwk.(crypto.Signer); ok {
+			return signer.Public(), "jwk", nil
+		}
+		return jwk, "jwk", nil
+	}
+	if sshKey, _, _, _, err := ssh.ParseAuthorizedKey(trimmed); err == nil {
+		cryptoKey, ok := sshKey.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, "", errors.New("unsupported key type")
+		}
+		return cryptoKey.CryptoPublicKey(), "authorized_keys", nil
+	}
+
+	if block, _ := pem.Decode(key); block == nil {
+		der, ok := keygen.DecodeDER(trimmed)
+		if !ok {
+			return nil, "", errors.New("can not decode key")
+		}
+		for _, format := range []string{"spki", "pkcs1", "x509"} {
+			if publicKey, err := parsePublicKeyDER(der, format); err == nil {
+				return publicKey, format + "-der", nil
+			}
+		}
+		signer, format, _, err := keygen.ParsePrivateKey(key, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		return signer.Public(), format, nil
+	}
+
+	for rest := key; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			// keys generated before the PKCS #1 label fix carry PKCS #1 data under the "PUBLIC KEY" label
+			if publicKey, err := parsePublicKeyDER(block.Bytes, "spki"); err == nil {
+				return publicKey, "spki", nil
+			}
+			publicKey, err := parsePublicKeyDER(block.Bytes, "pkcs1")
+			return publicKey, "pkcs1", err
+		case "RSA PUBLIC KEY":
+			publicKey, err := parsePublicKeyDER(block.Bytes, "pkcs1")
+			return publicKey, "pkcs1", err
+		case "CERTIFICATE":
+			publicKey, err := parsePublicKeyDER(block.Bytes, "x509")
+			return publicKey, "x509", err
+		}
+	}
+	signer, format, _, err := keygen.ParsePrivateKey(key, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return signer.Public(), format, nil
+}
+
+// parsePublicKeyDER parses a SubjectPublicKeyInfo, PKCS #1 public key or the public key of an X.509 certificate
+func parsePublicKeyDER(der []byte, format string) (crypto.PublicKey, error) {
+	switch format {
+	case "pkcs1":
+		return x509.ParsePKCS1PublicKey(der)
+	case "x509":
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		return certificate.PublicKey, nil
+	}
+	return x509.ParsePKIXPublicKey(der)
+}
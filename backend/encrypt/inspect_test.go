@@ -0,0 +1,174 @@
+package encrypt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"../keygen"
+	"golang.org/x/crypto/ssh"
+)
+
+type inspectResult struct {
+	Private          bool              `json:"private"`
+	Format           string            `json:"format"`
+	Algorithm        string            `json:"algorithm"`
+	Bits             int               `json:"bits"`
+	Curve            string            `json:"curve"`
+	PublicExponent   int               `json:"publicExponent"`
+	Fingerprints     map[string]string `json:"fingerprints"`
+	MatchesPublicKey *bool             `json:"matchesPublicKey"`
+	Warnings         []string          `json:"warnings"`
+}
+
+func TestInspectKeyRSAFormats(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}))
+
+	fingerprint := ""
+	for _, format := range []string{"pkcs1", "pkcs8", "jwk", "jwks", "openssh"} {
+		encoded, err := keygen.EncodeKeyPair(key, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := inspectKey(t, url.Values{"key": {string(encoded)}, "publicKey": {publicKey}})
+		expectedFormat := strings.TrimSuffix(format, "s")
+		if !result.Private || result.Format != expectedFormat || result.Algorithm != "RSA" || result.Bits != 1024 || result.PublicExponent != 65537 {
+			t.Errorf("InspectKey returned incorrect details for %v: %+v", format, result)
+		}
+		if result.MatchesPublicKey == nil || !*result.MatchesPublicKey {
+			t.Errorf("InspectKey did not match the public key for %v", format)
+		}
+		if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "2048") {
+			t.Errorf("InspectKey returned incorrect warnings for %v: %v", format, result.Warnings)
+		}
+		if fingerprint == "" {
+			fingerprint = result.Fingerprints["sshSHA256"]
+		} else if result.Fingerprints["sshSHA256"] != fingerprint {
+			t.Errorf("InspectKey returned different fingerprints for %v: %v", format, result.Fingerprints)
+		}
+		if result.Fingerprints["jwkThumbprint"] == "" || result.Fingerprints["spkiSHA256"] == "" {
+			t.Errorf("InspectKey returned incomplete fingerprints for %v: %v", format, result.Fingerprints)
+		}
+	}
+}
+
+func TestInspectKeyPublicKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := keygen.NewJSONWebKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedJWK, err := json.Marshal(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"spki":            string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})),
+		"spki-der":        base64.StdEncoding.EncodeToString(spki),
+		"authorized_keys": string(ssh.MarshalAuthorizedKey(sshKey)),
+		"jwk":             string(encodedJWK),
+	}
+	for format, encoded := range cases {
+		result := inspectKey(t, url.Values{"key": {encoded}})
+		if result.Private || result.Format != format || result.Algorithm != "ECDSA" || result.Bits != 384 || result.Curve != "P-384" {
+			t.Errorf("InspectKey returned incorrect details for %v: %+v", format, result)
+		}
+		if result.Fingerprints["sshSHA256"] != ssh.FingerprintSHA256(sshKey) || result.Fingerprints["jwkThumbprint"] != jwk.Kid {
+			t.Errorf("InspectKey returned incorrect fingerprints for %v: %v", format, result.Fingerprints)
+		}
+		if len(result.Warnings) != 0 || result.MatchesPublicKey != nil {
+			t.Errorf("InspectKey returned unexpected warnings or match for %v: %+v", format, result)
+		}
+	}
+}
+
+func TestInspectKeyEd25519Mismatch(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := url.Values{"key": {base64.StdEncoding.EncodeToString(pkcs8)}, "publicKey": {base64.StdEncoding.EncodeToString(spki)}}
+	result := inspectKey(t, payload)
+	if !result.Private || result.Format != "pkcs8-der" || result.Algorithm != "Ed25519" || result.Bits != 256 {
+		t.Errorf("InspectKey returned incorrect details: %+v", result)
+	}
+	if result.MatchesPublicKey == nil || *result.MatchesPublicKey {
+		t.Error("InspectKey matched a different public key")
+	}
+	if _, ok := result.Fingerprints["jwkThumbprint"]; !ok {
+		t.Errorf("InspectKey did not return a JWK thumbprint for an Ed25519 key: %v", result.Fingerprints)
+	}
+}
+
+func TestInspectKeyInvalid(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"not a key":                           "invalid key",
+		string(pem.EncodeToMemory(encrypted)): "passphrase required for encrypted keys",
+	}
+	for key, expected := range cases {
+		rr := postForm(t, InspectKey, "/key/inspect", url.Values{"key": {key}})
+		if rr.Code != http.StatusBadRequest || rr.Body.String() != expected {
+			t.Errorf("InspectKey returned unexpected response: got: %v %v, expected: %v", rr.Code, rr.Body.String(), expected)
+		}
+	}
+}
+
+func inspectKey(t *testing.T, payload url.Values) inspectResult {
+	rr := postForm(t, InspectKey, "/key/inspect", payload)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("InspectKey returned incorrect status code: got: %v, expected: %v, body: %v", status, http.StatusOK, rr.Body.String())
+	}
+	var result inspectResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
@@ -0,0 +1,334 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"../auth"
+	"../dbhelper"
+)
+
+var (
+	errKeyWrapIntegrity = errors.New("keywrap: integrity check failed")
+	errKeyWrapLength    = errors.New("keywrap: invalid key data length")
+	errKeyWrapKEK       = errors.New("keywrap: invalid key encryption key")
+	errKeyWrapAuth      = errors.New("keywrap: authentication required for stored keys")
+)
+
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+var keyWrapPadIV = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+// AESKeyWrap - POST /aes-kw/wrap, optionally authenticated
+// Params:
+// - kek : the hex-encoded AES key encryption key, generated by /aes/key or respecting its constraints and format
+// - kekID : the id of a stored AES key to use as key encryption key, used instead of kek (requires authentication)
+// - data : hex-encoded key to wrap, at least 128 bits and a multiple of 64 bits long
+// Returns:
+// - wrapped key as specified in RFC 3394, encoded in base64
+func AESKeyWrap(w http.ResponseWriter, r *http.Request) {
+	keyWrapHandler(w, r, aesKeyWrap)
+}
+
+// AESKeyUnwrap - POST /aes-kw/unwrap, optionally authenticated
+// Params:
+// - kek, kekID : the key encryption key, see /aes-kw/wrap
+// - data : non-empty base64 wrapped key
+// Returns:
+// - hex-encoded unwrapped key (plain text), which can be persisted as is through /keys;
+//   status code 400 if the integrity check fails
+func AESKeyUnwrap(w http.ResponseWriter, r *http.Request) {
+	keyUnwrapHandler(w, r, aesKeyUnwrap)
+}
+
+// AESKeyWrapPad - POST /aes-kwp/wrap, optionally authenticated
+// Params:
+// - kek, kekID : the key encryption key, see /aes-kw/wrap
+// - data : non-empty hex-encoded key to wrap, of any length
+// Returns:
+// - wrapped key as specified in RFC 5649, encoded in base64
+func AESKeyWrapPad(w http.ResponseWriter, r *http.Request) {
+	keyWrapHandler(w, r, aesKeyWrapPad)
+}
+
+// AESKeyUnwrapPad - POST /aes-kwp/unwrap, optionally authenticated
+// Params:
+// - kek, kekID : the key encryption key, see /aes-kw/wrap
+// - data : non-empty base64 wrapped key
+// Returns:
+// - hex-encoded unwrapped key (plain text), which can be persisted as is through /keys;
+//   status code 400 if the integrity check fails
+func AESKeyUnwrapPad(w http.ResponseWriter, r *http.Request) {
+	keyUnwrapHandler(w, r, aesKeyUnwrapPad)
+}
+
+func keyWrapHandler(w http.ResponseWriter, r *http.Request, wrap func(kek, data []byte) ([]byte, error)) {
+	r.ParseForm()
+
+	kek, ok := parseKEK(w, r)
+	if !ok {
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+	data, err := hex.DecodeString(dataValues[0])
+	if err != nil || len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	wrapped, err := wrap(kek, data)
+	if err == errKeyWrapLength {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data length"))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not wrap key: %v", err.Error())
+		return
+	}
+
+	w.Write([]byte(base64.StdEncoding.EncodeToString(wrapped)))
+}
+
+func keyUnwrapHandler(w http.ResponseWriter, r *http.Request, unwrap func(kek, data []byte) ([]byte, error)) {
+	r.ParseForm()
+
+	kek, ok := parseKEK(w, r)
+	if !ok {
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(dataValues[0])
+	if err != nil || len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	unwrapped, err := unwrap(kek, data)
+	if err == errKeyWrapLength || err == errKeyWrapIntegrity {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("data can not be unwrapped"))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not unwrap key: %v", err.Error())
+		return
+	}
+
+	w.Write([]byte(hex.EncodeToString(unwrapped)))
+}
+
+// parseKEK reads the key encryption key from either the kek or the kekID field, writing the error response on failure
+func parseKEK(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if kekIDValues, ok := r.PostForm["kekID"]; ok {
+		kek, err := findStoredKEK(r, kekIDValues[0])
+		if err == errKeyWrapAuth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil, false
+		} else if err == errKeyWrapKEK {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid kekID"))
+			return nil, false
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("can not retrieve key encryption key: %v", err.Error())
+			return nil, false
+		}
+		return kek, true
+	}
+
+	kekValues, ok := r.PostForm["kek"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field kek"))
+		return nil, false
+	}
+	kek, err := parseKey(kekValues[0])
+	if err != nil || !isAESKeyLength(len(kek)) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid kek"))
+		return nil, false
+	}
+	return kek, true
+}
+
+func findStoredKEK(r *http.Request, kekID string) ([]byte, error) {
+	userID, ok := auth.UserID(r)
+	if !ok {
+		return nil, errKeyWrapAuth
+	}
+
+	id, err := strconv.Atoi(kekID)
+	if err != nil {
+		return nil, errKeyWrapKEK
+	}
+	key, err := dbhelper.FindOwnedKey(id, userID, "AES")
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errKeyWrapKEK
+	}
+	kek, err := parseKey(key.Value)
+	if err != nil || !isAESKeyLength(len(kek)) {
+		return nil, errKeyWrapKEK
+	}
+	return kek, nil
+}
+
+func isAESKeyLength(length int) bool {
+	return length == 16 || length == 24 || length == 32
+}
+
+// aesKeyWrap implements the key wrap algorithm from RFC 3394, section 2.2.1
+func aesKeyWrap(kek, data []byte) ([]byte, error) {
+	if len(data) < 16 || len(data)%8 != 0 {
+		return nil, errKeyWrapLength
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return wrapBlocks(block, keyWrapIV, data), nil
+}
+
+// aesKeyUnwrap implements the key unwrap algorithm from RFC 3394, section 2.2.2
+func aesKeyUnwrap(kek, data []byte) ([]byte, error) {
+	if len(data) < 24 || len(data)%8 != 0 {
+		return nil, errKeyWrapLength
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	iv, result := unwrapBlocks(block, data)
+	if subtle.ConstantTimeCompare(iv, keyWrapIV) != 1 {
+		return nil, errKeyWrapIntegrity
+	}
+	return result, nil
+}
+
+// aesKeyWrapPad implements the key wrap with padding algorithm from RFC 5649, section 4.1
+func aesKeyWrapPad(kek, data []byte) ([]byte, error) {
+	if len(data) == 0 || uint64(len(data)) > 0xffffffff {
+		return nil, errKeyWrapLength
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, 8)
+	copy(iv, keyWrapPadIV)
+	binary.BigEndian.PutUint32(iv[4:], uint32(len(data)))
+	padded := make([]byte, (len(data)+7)/8*8)
+	copy(padded, data)
+
+	if len(padded) == 8 {
+		result := make([]byte, 16)
+		copy(result, iv)
+		copy(result[8:], padded)
+		block.Encrypt(result, result)
+		return result, nil
+	}
+	return wrapBlocks(block, iv, padded), nil
+}
+
+// aesKeyUnwrapPad implements the key unwrap with padding algorithm from RFC 5649, section 4.2
+func aesKeyUnwrapPad(kek, data []byte) ([]byte, error) {
+	if len(data) < 16 || len(data)%8 != 0 {
+		return nil, errKeyWrapLength
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	var iv, padded []byte
+	if len(data) == 16 {
+		plain := make([]byte, 16)
+		block.Decrypt(plain, data)
+		iv, padded = plain[:8], plain[8:]
+	} else {
+		iv, padded = unwrapBlocks(block, data)
+	}
+
+	// verify the alternative initial value, message length indicator and padding
+	valid := subtle.ConstantTimeCompare(iv[:4], keyWrapPadIV)
+	length := int(binary.BigEndian.Uint32(iv[4:]))
+	if length <= len(padded)-8 || length > len(padded) {
+		valid = 0
+	} else {
+		zeros := make([]byte, len(padded)-length)
+		valid &= subtle.ConstantTimeCompare(padded[length:], zeros)
+	}
+	if valid != 1 {
+		return nil, errKeyWrapIntegrity
+	}
+	return padded[:length], nil
+}
+
+// wrapBlocks is the wrapping process W from RFC 5649, section 2.2.1, i.e. the index based RFC 3394 wrap with a given initial value
+func wrapBlocks(block cipher.Block, iv, data []byte) []byte {
+	n := len(data) / 8
+	result := make([]byte, 8+len(data))
+	copy(result, iv)
+	copy(result[8:], data)
+
+	b := make([]byte, 16)
+	a := result[:8]
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, a)
+			copy(b[8:], result[i*8:i*8+8])
+			block.Encrypt(b, b)
+
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(result[i*8:], b[8:])
+		}
+	}
+	return result
+}
+
+// unwrapBlocks is the unwrapping process W^-1, returning the recovered initial value and key data
+func unwrapBlocks(block cipher.Block, data []byte) ([]byte, []byte) {
+	n := len(data)/8 - 1
+	a := make([]byte, 8)
+	copy(a, data[:8])
+	result := make([]byte, len(data)-8)
+	copy(result, data[8:])
+
+	b := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b, binary.BigEndian.Uint64(a)^t)
+			copy(b[8:], result[(i-1)*8:i*8])
+			block.Decrypt(b, b)
+
+			copy(a, b[:8])
+			copy(result[(i-1)*8:], b[8:])
+		}
+	}
+	return a, result
+}
@@ -0,0 +1,132 @@
+package encrypt
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestKeyWrapVectors(t *testing.T) {
+	vectors := []struct {
+		kek, key, wrapped string
+	}{
+		// RFC 3394, section 4.1
+		{"000102030405060708090A0B0C0D0E0F", "00112233445566778899AABBCCDDEEFF", "1FA68B0A8112B447 AEF34BD8FB5A7B82 9D3E862371D2CFE5"},
+		// RFC 3394, section 4.6
+		{"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F", "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F", "28C9F404C4B810F4 CBCCB35CFB87F826 3F5786E2D80ED326 CBC7F0E71A99F43B FB988B9B7A02DD21"},
+	}
+	for _, v := range vectors {
+		kek, key, expected := decodeHex(t, v.kek), decodeHex(t, v.key), decodeHex(t, v.wrapped)
+		wrapped, err := aesKeyWrap(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(wrapped, expected) {
+			t.Errorf("aesKeyWrap returned incorrect output: got: %x, expected: %x", wrapped, expected)
+		}
+		unwrapped, err := aesKeyUnwrap(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Errorf("aesKeyUnwrap returned incorrect output: got: %x, expected: %x", unwrapped, key)
+		}
+	}
+}
+
+func TestKeyWrapPadVectors(t *testing.T) {
+	// RFC 5649, section 6
+	kek := decodeHex(t, "5840df6e29b02af1 ab493b705bf16ea1 ae8338f4dcc176a8")
+	vectors := []struct {
+		key, wrapped string
+	}{
+		{"c37b7e6492584340 bed1220780894115 5068f738", "138bdeaa9b8fa7fc 61f97742e72248ee 5ae6ae5360d1ae6a 5f54f373fa543b6a"},
+		{"466f7250617369", "afbeb0f07dfbf541 9200f2ccb50bb24f"},
+	}
+	for _, v := range vectors {
+		key, expected := decodeHex(t, v.key), decodeHex(t, v.wrapped)
+		wrapped, err := aesKeyWrapPad(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(wrapped, expected) {
+			t.Errorf("aesKeyWrapPad returned incorrect output: got: %x, expected: %x", wrapped, expected)
+		}
+		unwrapped, err := aesKeyUnwrapPad(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Errorf("aesKeyUnwrapPad returned incorrect output: got: %x, expected: %x", unwrapped, key)
+		}
+	}
+}
+
+func TestAESKeyWrap(t *testing.T) {
+	kek := "000102030405060708090a0b0c0d0e0f"
+	key := "00112233445566778899aabbccddeeff"
+
+	payload := url.Values{"kek": {kek}, "data": {key}}
+	req, err := http.NewRequest("POST", "/aes-kw/wrap", strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(AESKeyWrap)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("AESKeyWrap incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	wrappedKey := rr.Body.String()
+
+	payload = url.Values{"kek": {kek}, "data": {wrappedKey}}
+	req, err = http.NewRequest("POST", "/aes-kw/unwrap", strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler = http.HandlerFunc(AESKeyUnwrap)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("AESKeyUnwrap incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	if key != rr.Body.String() {
+		t.Error("AESKeyWrap and AESKeyUnwrap are not inverse operations")
+	}
+
+	payload = url.Values{"kek": {"ff" + kek[2:]}, "data": {wrappedKey}}
+	req, err = http.NewRequest("POST", "/aes-kw/unwrap", strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("AESKeyUnwrap accepted incorrect kek: got: %v, expected: %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestAESKeyWrapStoredKeyUnauthenticated(t *testing.T) {
+	payload := url.Values{"kekID": {"1"}, "data": {"00112233445566778899aabbccddeeff"}}
+	req, err := http.NewRequest("POST", "/aes-kwp/wrap", strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(AESKeyWrapPad)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("AESKeyWrapPad incorrect status code: got: %v, expected: %v", status, http.StatusUnauthorized)
+	}
+}
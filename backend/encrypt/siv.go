@@ -0,0 +1,287 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// AESSIVEncrypt - POST /aes-siv/encrypt
+// Params:
+// - key : the key to use for encryption, generated by /aes-siv/key or respecting its constraints and format
+// - data : non-empty string to be encrypted
+// - associatedData : string authenticated along with data but not encrypted (optional, may be repeated)
+// Returns:
+// - synthetic IV followed by the encrypted text, encoded in base64
+// WARNING: AES-SIV is deterministic. The same key, associated data and plain text always produce the same
+// output, so anyone who can see the encrypted values learns which of them are equal. Use it only for fields
+// that need equality lookups, and pass a unique associatedData value (e.g. a nonce) where that is not needed.
+func AESSIVEncrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil || !isAESSIVKeyLength(len(key)) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	encryptedContent, err := aesSIVEncrypt(key, data, r.PostForm["associatedData"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("AESSIVEncrypt can not encrypt data: %v", err.Error())
+		return
+	}
+
+	w.Write([]byte(encryptedContent))
+}
+
+// AESSIVDecrypt - POST /aes-siv/decrypt
+// Params:
+// - key : the key to use for decryption
+// - data : non-empty base64 string to be decrypted
+// - associatedData : the associated data used for encryption, in the same order (optional, may be repeated)
+// Returns:
+// - decrypted plain text; status code 400 if the data or the associated data fail authentication
+func AESSIVDecrypt(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return
+	}
+	dataValues, ok := r.PostForm["data"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field data"))
+		return
+	}
+
+	key, err := parseKey(keyValues[0])
+	if err != nil || !isAESSIVKeyLength(len(key)) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return
+	}
+	data := dataValues[0]
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid data"))
+		return
+	}
+
+	decryptedContent, err := aesSIVDecrypt(key, data, r.PostForm["associatedData"])
+	if err == errSIVAuthentication {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("data can not be authenticated"))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("AESSIVDecrypt can not decrypt data: %v", err.Error())
+		return
+	}
+
+	w.Write([]byte(decryptedContent))
+}
+
+var errSIVAuthentication = errors.New("siv: authentication failed")
+
+// AES-SIV keys are two AES keys of equal length: the first for S2V, the second for CTR
+func isAESSIVKeyLength(length int) bool {
+	return length == 32 || length == 48 || length == 64
+}
+
+func aesSIVEncrypt(key []byte, data string, associatedData []string) (string, error) {
+	cipherText, err := sivSeal(key, []byte(data), toByteSlices(associatedData))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(cipherText), nil
+}
+
+func aesSIVDecrypt(key []byte, data string, associatedData []string) (string, error) {
+	cipherText, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	plainText, err := sivOpen(key, cipherText, toByteSlices(associatedData))
+	if err != nil {
+		return "", err
+	}
+	return string(plainText), nil
+}
+
+func toByteSlices(values []string) [][]byte {
+	result := make([][]byte, len(values))
+	for i, value := range values {
+		result[i] = []byte(value)
+	}
+	return result
+}
+
+// sivSeal implements SIV-AES as specified in RFC 5297, section 2.6
+func sivSeal(key, plainText []byte, associatedData [][]byte) ([]byte, error) {
+	macBlock, ctrBlock, err := sivCiphers(key)
+	if err != nil {
+		return nil, err
+	}
+
+	v := s2v(macBlock, append(associatedData[:len(associatedData):len(associatedData)], plainText))
+	result := make([]byte, aes.BlockSize+len(plainText))
+	copy(result, v)
+	cipher.NewCTR(ctrBlock, sivCounter(v)).XORKeyStream(result[aes.BlockSize:], plainText)
+	return result, nil
+}
+
+// sivOpen implements SIV-AES decryption as specified in RFC 5297, section 2.7
+func sivOpen(key, cipherText []byte, associatedData [][]byte) ([]byte, error) {
+	macBlock, ctrBlock, err := sivCiphers(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherText) < aes.BlockSize {
+		return nil, errSIVAuthentication
+	}
+
+	v := cipherText[:aes.BlockSize]
+	plainText := make([]byte, len(cipherText)-aes.BlockSize)
+	cipher.NewCTR(ctrBlock, sivCounter(v)).XORKeyStream(plainText, cipherText[aes.BlockSize:])
+
+	t := s2v(macBlock, append(associatedData[:len(associatedData):len(associatedData)], plainText))
+	if subtle.ConstantTimeCompare(t, v) != 1 {
+		return nil, errSIVAuthentication
+	}
+	return plainText, nil
+}
+
+func sivCiphers(key []byte) (cipher.Block, cipher.Block, error) {
+	if !isAESSIVKeyLength(len(key)) {
+		return nil, nil, errors.New("siv: invalid key length")
+	}
+	macBlock, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, nil, err
+	}
+	ctrBlock, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return macBlock, ctrBlock, nil
+}
+
+// sivCounter clears the 31st and 63rd bit (from the right) of the synthetic IV
+func sivCounter(v []byte) []byte {
+	q := make([]byte, aes.BlockSize)
+	copy(q, v)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	return q
+}
+
+// s2v is the vectorized PRF from RFC 5297, section 2.4; the last component is the plain text
+func s2v(block cipher.Block, components [][]byte) []byte {
+	d := cmac(block, make([]byte, aes.BlockSize))
+	for _, s := range components[:len(components)-1] {
+		d = dbl(d)
+		xorBytes(d, cmac(block, s))
+	}
+
+	last := components[len(components)-1]
+	var t []byte
+	if len(last) >= aes.BlockSize {
+		t = make([]byte, len(last))
+		copy(t, last)
+		xorBytes(t[len(t)-aes.BlockSize:], d)
+	} else {
+		t = dbl(d)
+		xorBytes(t, pad(last))
+	}
+	return cmac(block, t)
+}
+
+// cmac computes AES-CMAC as specified in RFC 4493
+func cmac(block cipher.Block, message []byte) []byte {
+	k1 := dbl(encryptBlock(block, make([]byte, aes.BlockSize)))
+	k2 := dbl(k1)
+
+	blockCount := (len(message) + aes.BlockSize - 1) / aes.BlockSize
+	var last []byte
+	if blockCount > 0 && len(message)%aes.BlockSize == 0 {
+		last = make([]byte, aes.BlockSize)
+		copy(last, message[len(message)-aes.BlockSize:])
+		xorBytes(last, k1)
+	} else {
+		if blockCount == 0 {
+			blockCount = 1
+		}
+		last = pad(message[(blockCount-1)*aes.BlockSize:])
+		xorBytes(last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < blockCount-1; i++ {
+		xorBytes(x, message[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+	xorBytes(x, last)
+	block.Encrypt(x, x)
+	return x
+}
+
+func encryptBlock(block cipher.Block, src []byte) []byte {
+	dst := make([]byte, aes.BlockSize)
+	block.Encrypt(dst, src)
+	return dst
+}
+
+// dbl multiplies the block by x in GF(2^128)
+func dbl(b []byte) []byte {
+	result := make([]byte, aes.BlockSize)
+	for i := 0; i < aes.BlockSize-1; i++ {
+		result[i] = b[i]<<1 | b[i+1]>>7
+	}
+	result[aes.BlockSize-1] = b[aes.BlockSize-1] << 1
+	if b[0]&0x80 != 0 {
+		result[aes.BlockSize-1] ^= 0x87
+	}
+	return result
+}
+
+// pad appends a single set bit and as many zero bits as needed to complete the block
+func pad(b []byte) []byte {
+	result := make([]byte, aes.BlockSize)
+	copy(result, b)
+	result[len(b)] = 0x80
+	return result
+}
+
+func xorBytes(dst, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
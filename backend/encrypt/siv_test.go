@@ -0,0 +1,138 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"../keygen"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// RFC 5297, appendix A.1
+func TestSIVDeterministicVector(t *testing.T) {
+	key := decodeHex(t, "fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0 f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff")
+	ad := decodeHex(t, "10111213 14151617 18191a1b 1c1d1e1f 20212223 24252627")
+	plainText := decodeHex(t, "11223344 55667788 99aabbcc ddee")
+	expected := decodeHex(t, "85632d07 c6e8f37f 950acd32 0a2ecc93 40c02b96 90c4dc04 daef7f6a fe5c")
+
+	cipherText, err := sivSeal(key, plainText, [][]byte{ad})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cipherText, expected) {
+		t.Errorf("sivSeal returned incorrect output: got: %x, expected: %x", cipherText, expected)
+	}
+
+	decrypted, err := sivOpen(key, cipherText, [][]byte{ad})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plainText) {
+		t.Errorf("sivOpen returned incorrect output: got: %x, expected: %x", decrypted, plainText)
+	}
+}
+
+// RFC 5297, appendix A.2
+func TestSIVNonceBasedVector(t *testing.T) {
+	key := decodeHex(t, "7f7e7d7c 7b7a7978 77767574 73727170 40414243 44454647 48494a4b 4c4d4e4f")
+	ad1 := decodeHex(t, "00112233 44556677 8899aabb ccddeeff deaddada deaddada ffeeddcc bbaa9988 77665544 33221100")
+	ad2 := decodeHex(t, "10203040 50607080 90a0")
+	nonce := decodeHex(t, "09f91102 9d74e35b d84156c5 635688c0")
+	plainText := decodeHex(t, "74686973 20697320 736f6d65 20706c61 696e7465 78742074 6f20656e 63727970 74207573 696e6720 5349562d 414553")
+	expected := decodeHex(t, "7bdb6e3b 432667eb 06f4d14b ff2fbd0f cb900f2f ddbe4043 26601965 c889bf17 dba77ceb 094fa663 b7a3f748 ba8af829 ea64ad54 4a272e9c 485b62a3 fd5c0d")
+
+	cipherText, err := sivSeal(key, plainText, [][]byte{ad1, ad2, nonce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cipherText, expected) {
+		t.Errorf("sivSeal returned incorrect output: got: %x, expected: %x", cipherText, expected)
+	}
+
+	if _, err := sivOpen(key, cipherText, [][]byte{ad1, nonce}); err != errSIVAuthentication {
+		t.Error("sivOpen accepted incorrect associated data")
+	}
+}
+
+func TestAESSIV(t *testing.T) {
+	req, err := http.NewRequest("GET", "/aes-siv/key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := req.URL.Query()
+	query.Add("keyLength", "512")
+	req.URL.RawQuery = query.Encode()
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(keygen.AESSIVKey)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Key generation returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	key := rr.Body.String()
+
+	data := "sample text to encrypt"
+	encrypt := func() string {
+		payload := url.Values{"key": {key}, "data": {data}, "associatedData": {"users.email"}}
+		req, err := http.NewRequest("POST", "/aes-siv/encrypt", strings.NewReader(payload.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(AESSIVEncrypt)
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("AESSIVEncrypt incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+		}
+		return rr.Body.String()
+	}
+
+	encryptedData := encrypt()
+	if data == encryptedData {
+		t.Error("AESSIVEncrypt does nothing")
+	}
+	if encryptedData != encrypt() {
+		t.Error("AESSIVEncrypt is not deterministic")
+	}
+
+	decrypt := func(associatedData string) *httptest.ResponseRecorder {
+		payload := url.Values{"key": {key}, "data": {encryptedData}, "associatedData": {associatedData}}
+		req, err := http.NewRequest("POST", "/aes-siv/decrypt", strings.NewReader(payload.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(AESSIVDecrypt)
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr = decrypt("users.email")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("AESSIVDecrypt incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	if data != rr.Body.String() {
+		t.Error("AESSIVEncrypt and AESSIVDecrypt are not inverse operations")
+	}
+
+	rr = decrypt("users.name")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("AESSIVDecrypt accepted incorrect associated data: got: %v, expected: %v", status, http.StatusBadRequest)
+	}
+}
@@ -247,3 +247,91 @@ func TestSHA512Missing(t *testing.T) {
 		t.Errorf("SHA256 returned incorrect status code: got: %v, expected: %v", status, http.StatusBadRequest)
 	}
 }
+
+func TestKDFVectors(t *testing.T) {
+	vectors := []struct {
+		name     string
+		payload  url.Values
+		expected string
+	}{
+		// RFC 5869, appendix A.1
+		{"hkdf sha-256", url.Values{"algorithm": {"hkdf"}, "encoding": {"hex"}, "secret": {"0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b"},
+			"salt": {"000102030405060708090a0b0c"}, "info": {"f0f1f2f3f4f5f6f7f8f9"}, "length": {"42"}},
+			"3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"},
+		// RFC 5869, appendix A.3, without salt and info
+		{"hkdf no salt", url.Values{"algorithm": {"hkdf"}, "encoding": {"hex"}, "secret": {"0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b"}, "length": {"42"}},
+			"8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8"},
+		// RFC 6070, PBKDF2-HMAC-SHA1
+		{"pbkdf2 sha-1", url.Values{"algorithm": {"pbkdf2"}, "hash": {"sha-1"}, "secret": {"password"}, "salt": {"salt"}, "iterations": {"4096"}, "length": {"20"}},
+			"4b007901b765489abead49d926f721d065a429c1"},
+		// RFC 7914, section 12
+		{"scrypt", url.Values{"algorithm": {"scrypt"}, "secret": {"password"}, "salt": {"NaCl"}, "cost": {"1024"}, "blockSize": {"8"}, "parallelism": {"16"}, "length": {"64"}},
+			"fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		// reference implementation test vector, RFC 9106 vectors use a secret and associated data which the endpoint does not take
+		{"argon2id", url.Values{"algorithm": {"argon2id"}, "secret": {"password"}, "salt": {"somesalt"}, "iterations": {"2"}, "memory": {"65536"}, "parallelism": {"1"}},
+			"09316115d5cf24ed5a15a31a3ba326e5cf32edc24702987c02b6566f61913cf7"},
+	}
+	for _, v := range vectors {
+		rr := postKDF(t, v.payload)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("KDF %v returned incorrect status code: got: %v, expected: %v", v.name, status, http.StatusOK)
+		}
+		if rr.Body.String() != v.expected {
+			t.Errorf("KDF %v returned unexpected body: got: %v, expected: %v", v.name, rr.Body.String(), v.expected)
+		}
+	}
+}
+
+func TestKDFIncorrectFields(t *testing.T) {
+	payload := url.Values{"algorithm": {"scrypt"}, "secret": {"password"}, "cost": {"1000"}, "info": {"context"}}
+	rr := postKDF(t, payload)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("KDF returned incorrect status code: got: %v, expected: %v", status, http.StatusBadRequest)
+	}
+	expected := "incorrect fields: salt, info, cost"
+	if rr.Body.String() != expected {
+		t.Errorf("KDF returned unexpected body: got: %v, expected: %v", rr.Body.String(), expected)
+	}
+}
+
+func TestKDFWorkLimits(t *testing.T) {
+	cases := map[string]url.Values{
+		"incorrect fields: iterations":  {"algorithm": {"pbkdf2"}, "iterations": {"2000001"}},
+		"incorrect fields: blockSize":   {"algorithm": {"scrypt"}, "cost": {"65536"}, "blockSize": {"16"}},
+		"incorrect fields: parallelism": {"algorithm": {"scrypt"}, "parallelism": {"17"}},
+		"incorrect fields: memory":      {"algorithm": {"argon2id"}, "memory": {"131072"}},
+	}
+	for expected, payload := range cases {
+		payload.Set("secret", "password")
+		payload.Set("salt", "salt")
+		rr := postKDF(t, payload)
+		if rr.Code != http.StatusBadRequest || rr.Body.String() != expected {
+			t.Errorf("KDF returned unexpected response: got: %v %v, expected: %v", rr.Code, rr.Body.String(), expected)
+		}
+	}
+	rr := postKDF(t, url.Values{"algorithm": {"argon2id"}, "secret": {"password"}, "salt": {"somesalt"}, "iterations": {"11"}})
+	if expected := "incorrect fields: iterations"; rr.Body.String() != expected {
+		t.Errorf("KDF returned unexpected body: got: %v, expected: %v", rr.Body.String(), expected)
+	}
+}
+
+func TestKDFMissingFields(t *testing.T) {
+	rr := postKDF(t, url.Values{})
+	expected := "missing fields: algorithm, secret"
+	if rr.Code != http.StatusBadRequest || rr.Body.String() != expected {
+		t.Errorf("KDF returned unexpected response: got: %v %v, expected: %v", rr.Code, rr.Body.String(), expected)
+	}
+}
+
+func postKDF(t *testing.T, payload url.Values) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/kdf", strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(KDF)
+	handler.ServeHTTP(rr, req)
+	return rr
+}
@@ -0,0 +1,223 @@
+package hashing
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const DEFAULT_KDF_LENGTH = 32
+
+const MAX_KDF_LENGTH = 1024
+
+const DEFAULT_PBKDF2_ITERATIONS = 600000
+
+const MAX_PBKDF2_ITERATIONS = 2000000
+
+const DEFAULT_SCRYPT_COST = 32768
+
+const MAX_SCRYPT_COST = 1 << 20
+
+const DEFAULT_ARGON2_ITERATIONS = 3
+
+const MAX_ARGON2_ITERATIONS = 10
+
+const DEFAULT_ARGON2_MEMORY = 64 * 1024
+
+// MAX_KDF_MEMORY bounds the memory used by scrypt and Argon2id, in KiB
+const MAX_KDF_MEMORY = 64 * 1024
+
+const MAX_KDF_PARALLELISM = 16
+
+var kdfHashes = map[string]func() hash.Hash{
+	"sha-1":   sha1.New,
+	"sha-256": sha256.New,
+	"sha-384": sha512.New384,
+	"sha-512": sha512.New,
+}
+
+// kdfParams are the inputs of a key derivation
+type kdfParams struct {
+	algorithm   string
+	secret      []byte
+	salt        []byte
+	info        []byte
+	hash        string
+	iterations  int
+	memory      int
+	cost        int
+	blockSize   int
+	parallelism int
+	length      int
+}
+
+// KDF - POST /kdf
+// Params:
+// - algorithm : hkdf (RFC 5869), pbkdf2 (RFC 8018), scrypt (RFC 7914) or argon2id (RFC 9106)
+// - secret : non-empty master secret or passphrase
+// - salt : salt, required for pbkdf2, scrypt and argon2id (optional for hkdf)
+// - info : context and application specific information, hkdf only (optional)
+// - encoding : text or hex, the encoding of secret, salt and info (optional, defaults to text)
+// - hash : sha-1, sha-256, sha-384 or sha-512, for hkdf and pbkdf2 (optional, defaults to sha-256)
+// - iterations : iteration count for pbkdf2 (optional, defaults to 600000, at most 2000000),
+//   or passes over the memory for argon2id (optional, defaults to 3, at most 10)
+// - memory : memory in KiB for argon2id, at least 8 * parallelism (optional, defaults to 65536, at most 65536)
+// - cost : CPU/memory cost N for scrypt, a power of 2 (optional, defaults to 32768)
+// - blockSize : block size r for scrypt (optional, defaults to 8); N * r * 128 bytes must not exceed 64 MiB,
+//   which with p at most 16 bounds the work N * r * p to 2^23
+// - parallelism : parallelism p for scrypt and argon2id, 1 to 16 (optional, defaults to 1 for scrypt and 4 for argon2id)
+// - length : output length in bytes, 1 to 1024 (optional, defaults to 32)
+// Returns:
+// - derived key, hex-encoded as the keys accepted by /aes/encrypt and the other encryption endpoints
+func KDF(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	missing := make([]string, 0, 2)
+	algorithmValues, ok := r.PostForm["algorithm"]
+	if !ok {
+		missing = append(missing, "algorithm")
+	}
+	if _, ok := r.PostForm["secret"]; !ok {
+		missing = append(missing, "secret")
+	}
+	if len(missing) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing fields: " + strings.Join(missing, ", ")))
+		return
+	}
+
+	params, incorrect := parseKDFParams(r, algorithmValues[0])
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	key, err := deriveKey(params)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("KDF: can not derive key: %v", err.Error())
+		return
+	}
+	w.Write([]byte(hex.EncodeToString(key)))
+}
+
+// parseKDFParams reads the params of the algorithm, checking its limits
+func parseKDFParams(r *http.Request, algorithm string) (params kdfParams, incorrect []string) {
+	params = kdfParams{
+		algorithm:   algorithm,
+		hash:        "sha-256",
+		iterations:  DEFAULT_PBKDF2_ITERATIONS,
+		memory:      DEFAULT_ARGON2_MEMORY,
+		cost:        DEFAULT_SCRYPT_COST,
+		blockSize:   8,
+		parallelism: 1,
+		length:      DEFAULT_KDF_LENGTH,
+	}
+	switch algorithm {
+	case "hkdf", "pbkdf2", "scrypt":
+	case "argon2id":
+		params.iterations, params.parallelism = DEFAULT_ARGON2_ITERATIONS, 4
+	default:
+		return params, []string{"algorithm"}
+	}
+
+	encoding := r.PostForm.Get("encoding")
+	if encoding != "" && encoding != "text" && encoding != "hex" {
+		incorrect = append(incorrect, "encoding")
+		encoding = "text"
+	}
+	decode := func(name string) []byte {
+		value := r.PostForm.Get(name)
+		if encoding != "hex" {
+			return []byte(value)
+		}
+		decoded, err := hex.DecodeString(value)
+		if err != nil {
+			incorrect = append(incorrect, name)
+		}
+		return decoded
+	}
+	params.secret = decode("secret")
+	if len(params.secret) == 0 {
+		incorrect = append(incorrect, "secret")
+	}
+	_, hasSalt := r.PostForm["salt"]
+	params.salt = decode("salt")
+	if algorithm != "hkdf" && (!hasSalt || len(params.salt) == 0) {
+		incorrect = append(incorrect, "salt")
+	}
+	if _, ok := r.PostForm["info"]; ok {
+		params.info = decode("info")
+		if algorithm != "hkdf" {
+			incorrect = append(incorrect, "info")
+		}
+	}
+
+	readInt := func(name string, value *int, min, max int) {
+		values, ok := r.PostForm[name]
+		if !ok {
+			return
+		}
+		var err error
+		*value, err = strconv.Atoi(values[0])
+		if err != nil || *value < min || *value > max {
+			incorrect = append(incorrect, name)
+		}
+	}
+	if hashValues, ok := r.PostForm["hash"]; ok {
+		params.hash = hashValues[0]
+		if _, ok := kdfHashes[params.hash]; !ok || (algorithm != "hkdf" && algorithm != "pbkdf2") {
+			incorrect = append(incorrect, "hash")
+		}
+	}
+	switch algorithm {
+	case "pbkdf2":
+		readInt("iterations", &params.iterations, 1, MAX_PBKDF2_ITERATIONS)
+	case "scrypt":
+		readInt("cost", &params.cost, 2, MAX_SCRYPT_COST)
+		readInt("blockSize", &params.blockSize, 1, 64)
+		readInt("parallelism", &params.parallelism, 1, MAX_KDF_PARALLELISM)
+		if params.cost&(params.cost-1) != 0 {
+			incorrect = append(incorrect, "cost")
+		} else if params.cost*params.blockSize/8 > MAX_KDF_MEMORY {
+			incorrect = append(incorrect, "blockSize")
+		}
+	case "argon2id":
+		readInt("iterations", &params.iterations, 1, MAX_ARGON2_ITERATIONS)
+		readInt("parallelism", &params.parallelism, 1, MAX_KDF_PARALLELISM)
+		readInt("memory", &params.memory, 8*params.parallelism, MAX_KDF_MEMORY)
+	}
+	readInt("length", &params.length, 1, MAX_KDF_LENGTH)
+	return
+}
+
+// deriveKey runs the key derivation function
+func deriveKey(params kdfParams) ([]byte, error) {
+	switch params.algorithm {
+	case "hkdf":
+		key := make([]byte, params.length)
+		if _, err := io.ReadFull(hkdf.New(kdfHashes[params.hash], params.secret, params.salt, params.info), key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	case "pbkdf2":
+		return pbkdf2.Key(params.secret, params.salt, params.iterations, params.length, kdfHashes[params.hash]), nil
+	case "scrypt":
+		return scrypt.Key(params.secret, params.salt, params.cost, params.blockSize, params.parallelism, params.length)
+	default:
+		return argon2.IDKey(params.secret, params.salt, uint32(params.iterations), uint32(params.memory), uint8(params.parallelism), uint32(params.length)), nil
+	}
+}
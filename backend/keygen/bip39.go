@@ -0,0 +1,300 @@
+package keygen
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+const DEFAULT_MNEMONIC_WORDS = 24
+
+const bip39Iterations = 2048
+
+// hardenedOffset is added to the index of hardened SLIP-0010 derivation path components
+const hardenedOffset = 0x80000000
+
+var bip39WordIndexes = func() map[string]int {
+	indexes := make(map[string]int, len(bip39EnglishWordList))
+	for i, word := range bip39EnglishWordList {
+		indexes[word] = i
+	}
+	return indexes
+}()
+
+var errMnemonicWordCount = errors.New("invalid word count - supported values: 12, 15, 18, 21, 24")
+
+var errMnemonicChecksum = errors.New("invalid checksum")
+
+// Mnemonic - GET /bip39/mnemonic
+// Params:
+// - words : 12, 15, 18, 21 or 24, for 128 to 256 bits of entropy (optional, defaults to 24)
+// Returns:
+// - BIP39 mnemonic of English words separated by single spaces (plain text)
+func Mnemonic(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	words := DEFAULT_MNEMONIC_WORDS
+	if wordsValues, ok := r.Form["words"]; ok {
+		var err error
+		words, err = strconv.Atoi(wordsValues[0])
+		if err != nil || words < 12 || words > 24 || words%3 != 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(errMnemonicWordCount.Error()))
+			return
+		}
+	}
+
+	entropy, err := GenerateKey(uint(words / 3 * 4))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GenerateKey() can not generate entropy: %v", err.Error())
+		return
+	}
+	w.Write([]byte(newMnemonic(entropy)))
+}
+
+// ValidateMnemonic - POST /bip39/validate
+// Params:
+// - mnemonic : BIP39 mnemonic of English words; case and extra whitespace are ignored
+// Returns:
+// - validation result in JSON format:
+//   "valid": boolean,
+//   "error": string, the unknown word, word count or checksum error, omitted for valid mnemonics
+func ValidateMnemonic(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	mnemonicValues, ok := r.PostForm["mnemonic"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field mnemonic"))
+		return
+	}
+
+	result := struct {
+		Valid bool   `json:"valid"`
+		Error string `json:"error,omitempty"`
+	}{
+		Valid: true,
+	}
+	if _, err := parseMnemonic(mnemonicValues[0]); err != nil {
+		result.Valid, result.Error = false, err.Error()
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize validation result to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// MnemonicKey - POST /bip39/key
+// Params:
+// - mnemonic : valid BIP39 mnemonic of English words
+// - passphrase : BIP39 passphrase, the "25th word" (optional, defaults to an empty passphrase)
+// - keyType : aes, twofish or ed25519
+// - keyLength : key length in bits for aes and twofish; supported values are 128, 192, 256 (optional, defaults to 256)
+// - path : derivation path; SLIP-0021 labels for aes and twofish, e.g. m/backups/aes/1,
+//   SLIP-0010 hardened indexes for ed25519, e.g. m/44'/0'/0'
+// - format : hex, base64 or jwk for aes and twofish (optional, defaults to hex),
+//   pkcs8 or openssh for ed25519 (optional, defaults to pkcs8)
+// Returns:
+// - key derived from the mnemonic seed in the requested format, the same inputs always give the same key
+func MnemonicKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	missing := make([]string, 0, 3)
+	mnemonicValues, ok := r.PostForm["mnemonic"]
+	if !ok {
+		missing = append(missing, "mnemonic")
+	}
+	keyTypeValues, ok := r.PostForm["keyType"]
+	if !ok {
+		missing = append(missing, "keyType")
+	}
+	pathValues, ok := r.PostForm["path"]
+	if !ok {
+		missing = append(missing, "path")
+	}
+	if len(missing) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing fields: " + strings.Join(missing, ", ")))
+		return
+	}
+
+	incorrect := make([]string, 0, 4)
+	if _, err := parseMnemonic(mnemonicValues[0]); err != nil {
+		incorrect = append(incorrect, "mnemonic")
+	}
+	keyType := keyTypeValues[0]
+	formats := symmetricKeyFormats
+	switch keyType {
+	case "aes", "twofish":
+	case "ed25519":
+		formats = ed25519KeyFormats
+	default:
+		incorrect = append(incorrect, "keyType")
+	}
+	keyLength := 256
+	if keyLengthValues, ok := r.PostForm["keyLength"]; ok {
+		var err error
+		keyLength, err = strconv.Atoi(keyLengthValues[0])
+		if err != nil || (keyLength != 128 && keyLength != 192 && keyLength != 256) || keyType == "ed25519" {
+			incorrect = append(incorrect, "keyLength")
+		}
+	}
+	var labels []string
+	var indexes []uint32
+	var err error
+	if keyType == "ed25519" {
+		indexes, err = parseHardenedPath(pathValues[0])
+	} else {
+		labels, err = parseLabelPath(pathValues[0])
+	}
+	if err != nil {
+		incorrect = append(incorrect, "path")
+	}
+	format, ok := parseKeyFormat(r, formats)
+	if !ok {
+		incorrect = append(incorrect, "format")
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	seed := mnemonicSeed(mnemonicValues[0], r.PostForm.Get("passphrase"))
+	if keyType == "ed25519" {
+		writeKeyPair(w, deriveEd25519Key(seed, indexes), format, keyProtection{})
+		return
+	}
+	writeSymmetricKeyBytes(w, deriveSymmetricKey(seed, labels)[:keyLength/8], format)
+}
+
+// newMnemonic encodes the entropy, 16 to 32 bytes in steps of 4, as a BIP39 mnemonic
+func newMnemonic(entropy []byte) string {
+	checksumBits := uint(len(entropy) / 4)
+	checksum := sha256.Sum256(entropy)
+	value := new(big.Int).SetBytes(entropy)
+	value.Lsh(value, checksumBits)
+	value.Or(value, big.NewInt(int64(checksum[0]>>(8-checksumBits))))
+
+	words := make([]string, (len(entropy)*8+int(checksumBits))/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = bip39EnglishWordList[new(big.Int).And(value, mask).Int64()]
+		value.Rsh(value, 11)
+	}
+	return strings.Join(words, " ")
+}
+
+// parseMnemonic checks the words and checksum of a BIP39 mnemonic and returns its entropy
+func parseMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(norm.NFKD.String(mnemonic)))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, errMnemonicWordCount
+	}
+
+	value := new(big.Int)
+	for _, word := range words {
+		index, ok := bip39WordIndexes[word]
+		if !ok {
+			return nil, errors.New("unknown word: " + word)
+		}
+		value.Lsh(value, 11)
+		value.Or(value, big.NewInt(int64(index)))
+	}
+
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(value, big.NewInt(int64(1)<<checksumBits-1)).Int64()
+	entropy := value.Rsh(value, checksumBits).FillBytes(make([]byte, len(words)/3*4))
+	expected := sha256.Sum256(entropy)
+	if int64(expected[0]>>(8-checksumBits)) != checksum {
+		return nil, errMnemonicChecksum
+	}
+	return entropy, nil
+}
+
+// mnemonicSeed computes the 64-byte BIP39 seed of the mnemonic and passphrase
+func mnemonicSeed(mnemonic, passphrase string) []byte {
+	words := strings.Fields(strings.ToLower(norm.NFKD.String(mnemonic)))
+	salt := "mnemonic" + norm.NFKD.String(passphrase)
+	return pbkdf2.Key([]byte(strings.Join(words, " ")), []byte(salt), bip39Iterations, 64, sha512.New)
+}
+
+// parseHardenedPath reads a SLIP-0010 derivation path of hardened indexes, e.g. m/44'/0'/0' or m/44h/0h/0h
+func parseHardenedPath(path string) ([]uint32, error) {
+	components := strings.Split(path, "/")
+	if components[0] != "m" {
+		return nil, errors.New("path must start with m")
+	}
+	indexes := make([]uint32, 0, len(components)-1)
+	for _, component := range components[1:] {
+		if !strings.HasSuffix(component, "'") && !strings.HasSuffix(component, "h") {
+			return nil, errors.New("ed25519 supports hardened derivation only")
+		}
+		index, err := strconv.ParseUint(component[:len(component)-1], 10, 31)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, uint32(index)+hardenedOffset)
+	}
+	return indexes, nil
+}
+
+// parseLabelPath reads a SLIP-0021 derivation path of non-empty labels, e.g. m/backups/aes/1
+func parseLabelPath(path string) ([]string, error) {
+	components := strings.Split(path, "/")
+	if components[0] != "m" {
+		return nil, errors.New("path must start with m")
+	}
+	for _, label := range components[1:] {
+		if label == "" {
+			return nil, errors.New("empty label")
+		}
+	}
+	return components[1:], nil
+}
+
+// deriveEd25519Key implements SLIP-0010 private key derivation for the ed25519 curve
+func deriveEd25519Key(seed []byte, indexes []uint32) ed25519.PrivateKey {
+	mac := hmac.New(sha512.New, []byte("ed25519 seed"))
+	mac.Write(seed)
+	node := mac.Sum(nil)
+	for _, index := range indexes {
+		data := make([]byte, 37)
+		copy(data[1:33], node[:32])
+		binary.BigEndian.PutUint32(data[33:], index)
+		mac = hmac.New(sha512.New, node[32:])
+		mac.Write(data)
+		node = mac.Sum(nil)
+	}
+	return ed25519.NewKeyFromSeed(node[:32])
+}
+
+// deriveSymmetricKey implements SLIP-0021 symmetric key derivation, returning the 32-byte key of the node
+func deriveSymmetricKey(seed []byte, labels []string) []byte {
+	mac := hmac.New(sha512.New, []byte("Symmetric key seed"))
+	mac.Write(seed)
+	node := mac.Sum(nil)
+	for _, label := range labels {
+		mac = hmac.New(sha512.New, node[:32])
+		mac.Write(append([]byte{0}, label...))
+		node = mac.Sum(nil)
+	}
+	return node[32:]
+}
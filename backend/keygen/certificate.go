@@ -0,0 +1,291 @@
+package keygen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_CERTIFICATE_VALIDITY_DAYS = 365
+
+const MAX_CERTIFICATE_VALIDITY_DAYS = 3650
+
+var keyUsages = map[string]x509.KeyUsage{
+	"digitalSignature":  x509.KeyUsageDigitalSignature,
+	"contentCommitment": x509.KeyUsageContentCommitment,
+	"keyEncipherment":   x509.KeyUsageKeyEncipherment,
+	"dataEncipherment":  x509.KeyUsageDataEncipherment,
+	"keyAgreement":      x509.KeyUsageKeyAgreement,
+	"certSign":          x509.KeyUsageCertSign,
+	"crlSign":           x509.KeyUsageCRLSign,
+}
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"ocspSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// SelfSignedCertificate - POST /x509/self-signed
+// Params:
+// - keyType : rsa or ecdsa (optional, defaults to ecdsa)
+// - keyLength : RSA key length in bits; supported values are 2048, 3072, 4096 (optional, defaults to 2048)
+// - curve : ECDSA curve, P-256, P-384 or P-521 (optional, defaults to P-256)
+// - commonName : non-empty string
+// - organization, organizationalUnit, country, province, locality : subject fields (optional)
+// - dnsNames : DNS subject alternative name, may be repeated (optional)
+// - ipAddresses : IPv4 or IPv6 subject alternative name, may be repeated (optional)
+// - validity : positive integer, validity in days (optional, defaults to 365, at most 3650)
+// - keyUsage : digitalSignature, contentCommitment, keyEncipherment, dataEncipherment, keyAgreement, certSign or crlSign,
+//   may be repeated (optional, defaults to digitalSignature, with keyEncipherment for RSA and certSign, crlSign for CAs)
+// - extKeyUsage : serverAuth, clientAuth, codeSigning, emailProtection, timeStamping or ocspSigning,
+//   may be repeated (optional, defaults to serverAuth for end-entity certificates)
+// - isCA : true to issue a CA certificate (optional)
+// Returns:
+// - certificate ("CERTIFICATE") and private key in PKCS #8 ("PRIVATE KEY") PEM format
+func SelfSignedCertificate(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	if _, ok := r.PostForm["commonName"]; !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field commonName"))
+		return
+	}
+
+	newKey, incorrect := ParseKeyOptions(r)
+	template, incorrectTemplate := parseCertificateTemplate(r, newKey.KeyType)
+	incorrect = append(incorrect, incorrectTemplate...)
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	privateKey, err := newKey.Generate()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not generate key: %v", err.Error())
+		return
+	}
+	if template.SerialNumber, err = GenerateSerialNumber(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not generate serial number: %v", err.Error())
+		return
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not create certificate: %v", err.Error())
+		return
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not encode private key: %v", err.Error())
+		return
+	}
+
+	w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}))
+	w.Write(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+}
+
+// KeyOptions describes a key pair to generate
+type KeyOptions struct {
+	KeyType string
+	Bits    int
+	Curve   string
+}
+
+// ParseKeyOptions reads the keyType, keyLength and curve params
+func ParseKeyOptions(r *http.Request) (options KeyOptions, incorrect []string) {
+	options = KeyOptions{KeyType: "ecdsa", Bits: 2048, Curve: "P-256"}
+	if keyTypeValues, ok := r.Form["keyType"]; ok {
+		options.KeyType = keyTypeValues[0]
+		if options.KeyType != "rsa" && options.KeyType != "ecdsa" {
+			incorrect = append(incorrect, "keyType")
+		}
+	}
+	if keyLengthValues, ok := r.Form["keyLength"]; ok {
+		bits, err := strconv.Atoi(keyLengthValues[0])
+		if err != nil || (bits != 2048 && bits != 3072 && bits != 4096) {
+			incorrect = append(incorrect, "keyLength")
+		}
+		options.Bits = bits
+	}
+	if curveValues, ok := r.Form["curve"]; ok {
+		options.Curve = curveValues[0]
+		if parseCurve(options.Curve) == nil {
+			incorrect = append(incorrect, "curve")
+		}
+	}
+	return
+}
+
+// Generate creates a new private key with the options
+func (options KeyOptions) Generate() (crypto.Signer, error) {
+	if options.KeyType == "rsa" {
+		return TakeRSAKey(options.Bits)
+	}
+	return ecdsa.GenerateKey(parseCurve(options.Curve), rand.Reader)
+}
+
+// ParseSubject reads the subject fields, commonName is required
+func ParseSubject(r *http.Request) (subject pkix.Name, incorrect []string) {
+	subject.CommonName = r.Form.Get("commonName")
+	if subject.CommonName == "" || len(subject.CommonName) > 64 {
+		incorrect = append(incorrect, "commonName")
+	}
+	fields := []struct {
+		name  string
+		value *[]string
+	}{
+		{"organization", &subject.Organization},
+		{"organizationalUnit", &subject.OrganizationalUnit},
+		{"country", &subject.Country},
+		{"province", &subject.Province},
+		{"locality", &subject.Locality},
+	}
+	for _, field := range fields {
+		if value := r.Form.Get(field.name); value != "" {
+			*field.value = []string{value}
+		}
+	}
+	if len(subject.Country) > 0 && len(subject.Country[0]) != 2 {
+		incorrect = append(incorrect, "country")
+	}
+	return
+}
+
+// ParseSubjectAlternativeNames reads the repeated dnsNames and ipAddresses params
+func ParseSubjectAlternativeNames(r *http.Request) (dnsNames []string, ipAddresses []net.IP, incorrect []string) {
+	for _, name := range r.Form["dnsNames"] {
+		if !isDNSName(name) {
+			incorrect = append(incorrect, "dnsNames")
+			break
+		}
+		dnsNames = append(dnsNames, name)
+	}
+	for _, address := range r.Form["ipAddresses"] {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			incorrect = append(incorrect, "ipAddresses")
+			break
+		}
+		ipAddresses = append(ipAddresses, ip)
+	}
+	return
+}
+
+// parseCertificateTemplate reads the subject, subject alternative names, validity, key usages and isCA params
+func parseCertificateTemplate(r *http.Request, keyType string) (*x509.Certificate, []string) {
+	template := &x509.Certificate{BasicConstraintsValid: true}
+
+	subject, incorrect := ParseSubject(r)
+	template.Subject = subject
+	dnsNames, ipAddresses, incorrectNames := ParseSubjectAlternativeNames(r)
+	template.DNSNames, template.IPAddresses = dnsNames, ipAddresses
+	incorrect = append(incorrect, incorrectNames...)
+
+	if isCAValues, ok := r.Form["isCA"]; ok {
+		isCA, err := strconv.ParseBool(isCAValues[0])
+		if err != nil {
+			incorrect = append(incorrect, "isCA")
+		}
+		template.IsCA = isCA
+	}
+
+	incorrect = append(incorrect, ParseCertificateOptions(r, template, keyType, DEFAULT_CERTIFICATE_VALIDITY_DAYS)...)
+	return template, incorrect
+}
+
+// ParseCertificateOptions reads the validity and key usage params into the template,
+// the default key usages depend on the key type and template.IsCA
+func ParseCertificateOptions(r *http.Request, template *x509.Certificate, keyType string, defaultValidity int) (incorrect []string) {
+	validity := defaultValidity
+	if validityValues, ok := r.Form["validity"]; ok {
+		var err error
+		validity, err = strconv.Atoi(validityValues[0])
+		if err != nil || validity <= 0 || validity > MAX_CERTIFICATE_VALIDITY_DAYS {
+			incorrect = append(incorrect, "validity")
+		}
+	}
+	// backdated slightly to tolerate clock skew
+	template.NotBefore = time.Now().Add(-5 * time.Minute).UTC().Truncate(time.Second)
+	template.NotAfter = template.NotBefore.AddDate(0, 0, validity)
+
+	if keyUsageValues, ok := r.Form["keyUsage"]; ok {
+		for _, name := range keyUsageValues {
+			usage, ok := keyUsages[name]
+			if !ok {
+				incorrect = append(incorrect, "keyUsage")
+				break
+			}
+			template.KeyUsage |= usage
+		}
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		if keyType == "rsa" {
+			template.KeyUsage |= x509.KeyUsageKeyEncipherment
+		}
+		if template.IsCA {
+			template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		}
+	}
+
+	if extKeyUsageValues, ok := r.Form["extKeyUsage"]; ok {
+		for _, name := range extKeyUsageValues {
+			usage, ok := extKeyUsages[name]
+			if !ok {
+				incorrect = append(incorrect, "extKeyUsage")
+				break
+			}
+			template.ExtKeyUsage = append(template.ExtKeyUsage, usage)
+		}
+	} else if !template.IsCA {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	return
+}
+
+// GenerateSerialNumber returns a random positive 128-bit serial number
+func GenerateSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	return serialNumber.Add(serialNumber, big.NewInt(1)), nil
+}
+
+// isDNSName checks the syntax of a host name, optionally with a leading wildcard label
+func isDNSName(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
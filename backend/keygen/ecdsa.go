@@ -0,0 +1,70 @@
+package keygen
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"log"
+	"net/http"
+)
+
+// ECDSAKey - GET /ecdsa/key, POST /ecdsa/key
+// Params:
+// - curve : P-256, P-384 or P-521
+// - format : pkcs8, sec1, jwk, jwks or openssh (optional, defaults to pkcs8)
+// - passphrase : passphrase to encrypt the private key with, pkcs8 and openssh only; read from the POST body only
+//   so that it does not end up in logs (optional, defaults to an unencrypted key)
+// - kdf : scrypt or pbkdf2, the PBES2 key derivation function for pkcs8 (optional, defaults to scrypt)
+// Returns:
+// - pkcs8 or sec1: private key in PKCS #8 ("PRIVATE KEY") or SEC 1 ("EC PRIVATE KEY") PEM format,
+//   public key in SubjectPublicKeyInfo ("PUBLIC KEY") PEM format; with a passphrase, the private key
+//   is an encrypted PKCS #8 PEM block ("ENCRYPTED PRIVATE KEY", PBES2 with AES-256-CBC)
+// - jwk: private JSON Web Key, jwks: JSON Web Key Set containing it
+// - openssh: private key in OpenSSH PEM format, public key in authorized_keys format
+func ECDSAKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	curveValues, ok := r.Form["curve"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field curve"))
+		return
+	}
+
+	curve := parseCurve(curveValues[0])
+	if curve == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid curve - supported values: P-256, P-384, P-521"))
+		return
+	}
+	format, ok := parseKeyFormat(r, ecdsaKeyFormats)
+	if !ok {
+		invalidFormat(w, ecdsaKeyFormats)
+		return
+	}
+	protection, ok := parseKeyProtection(w, r, &format)
+	if !ok {
+		return
+	}
+
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("ecdsa.GenerateKey() failed with error %v", err.Error())
+		return
+	}
+	writeKeyPair(w, privateKey, format, protection)
+}
+
+// parseCurve returns the NIST curve with the given name, or nil for unsupported curves
+func parseCurve(name string) elliptic.Curve {
+	switch name {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	}
+	return nil
+}
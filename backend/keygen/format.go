@@ -0,0 +1,534 @@
+package keygen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var symmetricKeyFormats = []string{"hex", "base64", "jwk"}
+
+var rsaKeyFormats = []string{"pkcs1", "pkcs8", "jwk", "jwks", "openssh"}
+
+var ecdsaKeyFormats = []string{"pkcs8", "sec1", "jwk", "jwks", "openssh"}
+
+var ed25519KeyFormats = []string{"pkcs8", "openssh"}
+
+// JSONWebKey is a key in JWK format (RFC 7517)
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	D   string `json:"d,omitempty"`
+	P   string `json:"p,omitempty"`
+	Q   string `json:"q,omitempty"`
+	Dp  string `json:"dp,omitempty"`
+	Dq  string `json:"dq,omitempty"`
+	Qi  string `json:"qi,omitempty"`
+	K   string `json:"k,omitempty"`
+}
+
+// parseKeyFormat reads the format param, returning the default format if it is not set
+func parseKeyFormat(r *http.Request, formats []string) (string, bool) {
+	formatValues, ok := r.Form["format"]
+	if !ok {
+		return formats[0], true
+	}
+	for _, format := range formats {
+		if formatValues[0] == format {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// invalidFormat writes the error message listing the supported formats
+func invalidFormat(w http.ResponseWriter, formats []string) {
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte("invalid format - supported values: " + strings.Join(formats, ", ")))
+}
+
+// writeSymmetricKey generates a random key and writes it in the requested format:
+// hex (default), base64 or jwk (JSON Web Key of type oct)
+func writeSymmetricKey(w http.ResponseWriter, r *http.Request, bytesCount uint) {
+	format, ok := parseKeyFormat(r, symmetricKeyFormats)
+	if !ok {
+		invalidFormat(w, symmetricKeyFormats)
+		return
+	}
+	writeGeneratedSymmetricKey(w, bytesCount, format)
+}
+
+// writeLegacySymmetricKey is writeSymmetricKey for legacy algorithms, marking valid requests as deprecated
+func writeLegacySymmetricKey(w http.ResponseWriter, r *http.Request, bytesCount uint, algorithm string) {
+	format, ok := parseKeyFormat(r, symmetricKeyFormats)
+	if !ok {
+		invalidFormat(w, symmetricKeyFormats)
+		return
+	}
+	MarkDeprecated(w, algorithm)
+	writeGeneratedSymmetricKey(w, bytesCount, format)
+}
+
+// writeGeneratedSymmetricKey generates a random key and writes it in one of the symmetricKeyFormats
+func writeGeneratedSymmetricKey(w http.ResponseWriter, bytesCount uint, format string) {
+	key, err := GenerateKey(bytesCount)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GenerateKey() can not generate key: %v", err.Error())
+		return
+	}
+	writeSymmetricKeyBytes(w, key, format)
+}
+
+// writeSymmetricKeyBytes writes the key in one of the symmetricKeyFormats
+func writeSymmetricKeyBytes(w http.ResponseWriter, key []byte, format string) {
+	result, err := EncodeSymmetricKey(key, format)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize key to json: %v", err)
+		return
+	}
+	if format == "jwk" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(result)
+}
+
+// EncodeSymmetricKey encodes the key as hex (default), base64 or a JSON Web Key of type oct
+func EncodeSymmetricKey(key []byte, format string) ([]byte, error) {
+	switch format {
+	case "base64":
+		return []byte(base64.StdEncoding.EncodeToString(key)), nil
+	case "jwk":
+		return json.Marshal(JSONWebKey{Kty: "oct", K: base64.RawURLEncoding.EncodeToString(key)})
+	}
+	return []byte(hex.EncodeToString(key)), nil
+}
+
+// keyProtection is the passphrase and PBES2 key derivation function to encrypt private keys with
+type keyProtection struct {
+	passphrase string
+	kdf        string
+}
+
+// parseKeyProtection reads the passphrase and kdf params, writing the error response on failure;
+// a passphrase changes the default format to pkcs8 and requires the pkcs8 or openssh format
+func parseKeyProtection(w http.ResponseWriter, r *http.Request, format *string) (keyProtection, bool) {
+	protection := keyProtection{passphrase: r.PostForm.Get("passphrase"), kdf: PKCS8KDFs[0]}
+	if passphraseInQuery(r) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid passphrase - send it in the POST body"))
+		return protection, false
+	}
+	if kdfValues, ok := r.Form["kdf"]; ok {
+		protection.kdf = kdfValues[0]
+		if !containsString(PKCS8KDFs, protection.kdf) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid kdf - supported values: " + strings.Join(PKCS8KDFs, ", ")))
+			return protection, false
+		}
+	}
+	if protection.passphrase == "" {
+		return protection, true
+	}
+	if _, ok := r.Form["format"]; !ok {
+		*format = "pkcs8"
+	}
+	if *format != "pkcs8" && *format != "openssh" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid format - supported values with a passphrase: pkcs8, openssh"))
+		return protection, false
+	}
+	return protection, true
+}
+
+// writeKeyPair writes the private and public key in the requested format, with the private key encrypted
+// if the protection has a passphrase
+func writeKeyPair(w http.ResponseWriter, key crypto.Signer, format string, protection keyProtection) {
+	var result []byte
+	var err error
+	if protection.passphrase != "" {
+		result, err = EncodeProtectedKeyPair(key, format, []byte(protection.passphrase), protection.kdf)
+	} else {
+		result, err = EncodeKeyPair(key, format)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("EncodeKeyPair() can not encode key: %v", err.Error())
+		return
+	}
+	if format == "jwk" || format == "jwks" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(result)
+}
+
+// EncodeKeyPair encodes an RSA, ECDSA or Ed25519 private key and its public key:
+// - pkcs1 : PKCS #1 "RSA PRIVATE KEY" and "RSA PUBLIC KEY" PEM blocks (RSA only)
+// - sec1 : SEC 1 "EC PRIVATE KEY" and SubjectPublicKeyInfo "PUBLIC KEY" PEM blocks (ECDSA only)
+// - pkcs8 : PKCS #8 "PRIVATE KEY" and SubjectPublicKeyInfo "PUBLIC KEY" PEM blocks
+// - jwk : private JSON Web Key, which includes the public key
+// - jwks : JSON Web Key Set with the private JSON Web Key
+// - openssh : "OPENSSH PRIVATE KEY" PEM block and the public key in authorized_keys format
+func EncodeKeyPair(key crypto.Signer, format string) ([]byte, error) {
+	switch format {
+	case "jwk", "jwks":
+		jwk, err := NewJSONWebKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if format == "jwks" {
+			return json.Marshal(struct {
+				Keys []JSONWebKey `json:"keys"`
+			}{[]JSONWebKey{jwk}})
+		}
+		return json.Marshal(jwk)
+	case "openssh":
+		privateBlock, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := ssh.NewPublicKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		return append(pem.EncodeToMemory(privateBlock), ssh.MarshalAuthorizedKey(publicKey)...), nil
+	}
+
+	var privateBlock, publicBlock pem.Block
+	var err error
+	switch format {
+	case "pkcs1":
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("pkcs1 format requires an RSA key")
+		}
+		privateBlock = pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}
+		publicBlock = pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}
+		return append(pem.EncodeToMemory(&privateBlock), pem.EncodeToMemory(&publicBlock)...), nil
+	case "sec1":
+		ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("sec1 format requires an ECDSA key")
+		}
+		privateBlock.Type = "EC PRIVATE KEY"
+		privateBlock.Bytes, err = x509.MarshalECPrivateKey(ecdsaKey)
+	case "pkcs8":
+		privateBlock.Type = "PRIVATE KEY"
+		privateBlock.Bytes, err = x509.MarshalPKCS8PrivateKey(key)
+	default:
+		return nil, errors.New("unsupported format " + format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	publicBlock.Type = "PUBLIC KEY"
+	if publicBlock.Bytes, err = x509.MarshalPKIXPublicKey(key.Public()); err != nil {
+		return nil, err
+	}
+	return append(pem.EncodeToMemory(&privateBlock), pem.EncodeToMemory(&publicBlock)...), nil
+}
+
+// EncodeProtectedKeyPair encodes a private key encrypted with the passphrase and its public key:
+// - pkcs8 : PKCS #8 "ENCRYPTED PRIVATE KEY" (PBES2 with AES-256-CBC, scrypt or pbkdf2 kdf) and SubjectPublicKeyInfo "PUBLIC KEY" PEM blocks
+// - openssh : passphrase-protected "OPENSSH PRIVATE KEY" PEM block and the public key in authorized_keys format
+func EncodeProtectedKeyPair(key crypto.Signer, format string, passphrase []byte, kdf string) ([]byte, error) {
+	switch format {
+	case "pkcs8":
+		encrypted, err := MarshalEncryptedPKCS8PrivateKey(key, passphrase, kdf)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := EncodePublicKey(key.Public(), "spki")
+		if err != nil {
+			return nil, err
+		}
+		return append(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}), publicKey...), nil
+	case "openssh":
+		privateBlock, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", passphrase)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := EncodePublicKey(key.Public(), "openssh")
+		if err != nil {
+			return nil, err
+		}
+		return append(pem.EncodeToMemory(privateBlock), publicKey...), nil
+	}
+	return nil, errors.New("passphrase protection is not supported by format " + format)
+}
+
+// EncodePublicKey encodes an RSA, ECDSA or Ed25519 public key:
+// - spki : SubjectPublicKeyInfo "PUBLIC KEY" PEM block
+// - pkcs1 : PKCS #1 "RSA PUBLIC KEY" PEM block (RSA only)
+// - jwk : public JSON Web Key, jwks : JSON Web Key Set containing it
+// - openssh : authorized_keys format
+func EncodePublicKey(key crypto.PublicKey, format string) ([]byte, error) {
+	switch format {
+	case "spki":
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case "pkcs1":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("pkcs1 format requires an RSA key")
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(rsaKey)}), nil
+	case "jwk", "jwks":
+		jwk, err := NewJSONWebKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if format == "jwks" {
+			return json.Marshal(struct {
+				Keys []JSONWebKey `json:"keys"`
+			}{[]JSONWebKey{jwk}})
+		}
+		return json.Marshal(jwk)
+	case "openssh":
+		publicKey, err := ssh.NewPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return ssh.MarshalAuthorizedKey(publicKey), nil
+	}
+	return nil, errors.New("unsupported format " + format)
+}
+
+// NewJSONWebKey converts an RSA, ECDSA or Ed25519 key, private or public, to a JSON Web Key identified by its RFC 7638 thumbprint
+func NewJSONWebKey(key interface{}) (JSONWebKey, error) {
+	var jwk JSONWebKey
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		k.Precompute()
+		jwk = rsaPublicJSONWebKey(&k.PublicKey)
+		jwk.D = encodeJWKInteger(k.D, 0)
+		if len(k.Primes) == 2 {
+			jwk.P = encodeJWKInteger(k.Primes[0], 0)
+			jwk.Q = encodeJWKInteger(k.Primes[1], 0)
+			jwk.Dp = encodeJWKInteger(k.Precomputed.Dp, 0)
+			jwk.Dq = encodeJWKInteger(k.Precomputed.Dq, 0)
+			jwk.Qi = encodeJWKInteger(k.Precomputed.Qinv, 0)
+		}
+	case *rsa.PublicKey:
+		jwk = rsaPublicJSONWebKey(k)
+	case *ecdsa.PrivateKey:
+		var err error
+		if jwk, err = ecdsaPublicJSONWebKey(&k.PublicKey); err != nil {
+			return jwk, err
+		}
+		jwk.D = encodeJWKInteger(k.D, (k.Curve.Params().BitSize+7)/8)
+	case *ecdsa.PublicKey:
+		var err error
+		if jwk, err = ecdsaPublicJSONWebKey(k); err != nil {
+			return jwk, err
+		}
+	case ed25519.PrivateKey:
+		jwk = ed25519PublicJSONWebKey(k.Public().(ed25519.PublicKey))
+		jwk.D = base64.RawURLEncoding.EncodeToString(k.Seed())
+	case ed25519.PublicKey:
+		jwk = ed25519PublicJSONWebKey(k)
+	default:
+		return jwk, errors.New("unsupported key type")
+	}
+
+	// the thumbprint covers the required public members in lexicographic order
+	var thumbprintInput string
+	switch jwk.Kty {
+	case "RSA":
+		thumbprintInput = `{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`
+	case "OKP":
+		thumbprintInput = `{"crv":"` + jwk.Crv + `","kty":"OKP","x":"` + jwk.X + `"}`
+	default:
+		thumbprintInput = `{"crv":"` + jwk.Crv + `","kty":"EC","x":"` + jwk.X + `","y":"` + jwk.Y + `"}`
+	}
+	thumbprint := sha256.Sum256([]byte(thumbprintInput))
+	jwk.Kid = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	return jwk, nil
+}
+
+// ParseJSONWebKey converts an RSA, EC or OKP (Ed25519, RFC 8037) JSON Web Key, or the first key of a JSON Web Key Set,
+// to a private key if it has the private members, or to a public key otherwise; oct keys are returned as []byte
+func ParseJSONWebKey(data []byte) (interface{}, error) {
+	var jwk JSONWebKey
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, err
+	}
+	if jwk.Kty == "" {
+		var jwks struct {
+			Keys []JSONWebKey `json:"keys"`
+		}
+		if err := json.Unmarshal(data, &jwks); err != nil || len(jwks.Keys) == 0 {
+			return nil, errors.New("missing key type")
+		}
+		jwk = jwks.Keys[0]
+	}
+
+	switch jwk.Kty {
+	case "oct":
+		key, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(key) == 0 {
+			return nil, errors.New("invalid key value")
+		}
+		return key, nil
+	case "RSA":
+		n, err := decodeJWKInteger(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		if n.Cmp(big.NewInt(1)) <= 0 {
+			return nil, errors.New("invalid modulus")
+		}
+		e, err := decodeJWKInteger(jwk.E)
+		if err != nil || e.BitLen() > 31 || e.Cmp(big.NewInt(2)) < 0 || e.Bit(0) == 0 {
+			return nil, errors.New("invalid public exponent")
+		}
+		publicKey := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if jwk.D == "" {
+			return publicKey, nil
+		}
+
+		// the CRT members are recomputed, the primes are required to do so
+		d, err := decodeJWKInteger(jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		p, err := decodeJWKInteger(jwk.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := decodeJWKInteger(jwk.Q)
+		if err != nil {
+			return nil, err
+		}
+		privateKey := &rsa.PrivateKey{PublicKey: *publicKey, D: d, Primes: []*big.Int{p, q}}
+		if err := privateKey.Validate(); err != nil {
+			return nil, err
+		}
+		privateKey.Precompute()
+		return privateKey, nil
+	case "EC":
+		curve := parseCurve(jwk.Crv)
+		if curve == nil {
+			return nil, errors.New("unsupported curve " + jwk.Crv)
+		}
+		x, err := decodeJWKInteger(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInteger(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if jwk.D == "" {
+			return publicKey, nil
+		}
+
+		d, err := decodeJWKInteger(jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		if d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+			return nil, errors.New("invalid private key")
+		}
+		if dx, dy := curve.ScalarBaseMult(d.Bytes()); dx.Cmp(x) != 0 || dy.Cmp(y) != 0 {
+			return nil, errors.New("private key does not match the public key")
+		}
+		return &ecdsa.PrivateKey{PublicKey: *publicKey, D: d}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, errors.New("unsupported curve " + jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid public key")
+		}
+		publicKey := ed25519.PublicKey(x)
+		if jwk.D == "" {
+			return publicKey, nil
+		}
+
+		seed, err := base64.RawURLEncoding.DecodeString(jwk.D)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid private key")
+		}
+		privateKey := ed25519.NewKeyFromSeed(seed)
+		if !publicKey.Equal(privateKey.Public()) {
+			return nil, errors.New("private key does not match the public key")
+		}
+		return privateKey, nil
+	}
+	return nil, errors.New("unsupported key type " + jwk.Kty)
+}
+
+func ed25519PublicJSONWebKey(key ed25519.PublicKey) JSONWebKey {
+	return JSONWebKey{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(key)}
+}
+
+func rsaPublicJSONWebKey(key *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		N:   encodeJWKInteger(key.N, 0),
+		E:   encodeJWKInteger(big.NewInt(int64(key.E)), 0),
+	}
+}
+
+func ecdsaPublicJSONWebKey(key *ecdsa.PublicKey) (JSONWebKey, error) {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	jwk := JSONWebKey{
+		Kty: "EC",
+		Crv: key.Curve.Params().Name,
+		X:   encodeJWKInteger(key.X, size),
+		Y:   encodeJWKInteger(key.Y, size),
+	}
+	if jwk.Crv != "P-256" && jwk.Crv != "P-384" && jwk.Crv != "P-521" {
+		return jwk, errors.New("unsupported curve " + jwk.Crv)
+	}
+	return jwk, nil
+}
+
+// encodeJWKInteger encodes the integer as base64url, left-padded with zeros to size bytes if size is positive
+func encodeJWKInteger(value *big.Int, size int) string {
+	if size <= 0 {
+		return base64.RawURLEncoding.EncodeToString(value.Bytes())
+	}
+	return base64.RawURLEncoding.EncodeToString(value.FillBytes(make([]byte, size)))
+}
+
+// decodeJWKInteger decodes a non-empty base64url integer
+func decodeJWKInteger(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, errors.New("missing integer")
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
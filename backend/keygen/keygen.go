@@ -1,24 +1,39 @@
 package keygen
 
 import (
-	"bytes"
-	crand "crypto/rand"
+	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/hex"
-	"encoding/pem"
+	"io"
 	"log"
-	"math/rand"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-// RSAKey - GET /rsa/key
+const alphaLowerCharacters = "abcdefghijklmnopqrstuvwxyz"
+
+const alphaUpperCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+const numericCharacters = "0123456789"
+
+const specialCharacters = " !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// RSAKey - GET /rsa/key, POST /rsa/key
 // Params:
 //	- keyLength: non-negative integer representing the key length in bits; supported values are 1024, 2048, 3072, 4096.
+//	- format: pkcs1, pkcs8, jwk, jwks or openssh (optional, defaults to pkcs1, or to pkcs8 with a passphrase)
+//	- passphrase: passphrase to encrypt the private key with, pkcs8 and openssh only; read from the POST body only
+//	  so that it does not end up in logs (optional, defaults to an unencrypted key)
+//	- kdf: scrypt or pbkdf2, the PBES2 key derivation function for pkcs8 (optional, defaults to scrypt)
 // Returns:
-//	- private key in ASN.1 DER format, new line (\n), public key in ASN.1 DER format
+//	- pkcs1: private key and public key as PKCS #1 PEM blocks ("RSA PRIVATE KEY", "RSA PUBLIC KEY")
+//	- pkcs8: private key as PKCS #8 PEM block ("PRIVATE KEY"), public key as SubjectPublicKeyInfo PEM block ("PUBLIC KEY");
+//	  with a passphrase, the private key is an encrypted PKCS #8 PEM block ("ENCRYPTED PRIVATE KEY", PBES2 with AES-256-CBC)
+//	- jwk: private JSON Web Key, jwks: JSON Web Key Set containing it
+//	- openssh: private key in OpenSSH PEM format, public key in authorized_keys format
+// Keys are served from the pre-generated pool of their size if it is started and not empty.
 // Implementation is based on: https://gist.github.com/devinodaniel/8f9b8a4f31573f428f29ec0e884e6673
 func RSAKey(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
@@ -37,20 +52,31 @@ func RSAKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	privateKey, publicKey, err := generateRSAKeys(uint(keyLength / 8))
-	if err != nil {
-		log.Printf("generateRSAKeys() failed with error %v", err.Error())
+	format, ok := parseKeyFormat(r, rsaKeyFormats)
+	if !ok {
+		invalidFormat(w, rsaKeyFormats)
+		return
+	}
+	protection, ok := parseKeyProtection(w, r, &format)
+	if !ok {
+		return
 	}
 
-	w.Write(privateKey)
-	w.Write(publicKey)
+	privateKey, err := TakeRSAKey(keyLength)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("TakeRSAKey() failed with error %v", err.Error())
+		return
+	}
+	writeKeyPair(w, privateKey, format, protection)
 }
 
 // AESKey - GET /aes/key
 // Params:
 // - keyLength : non-negative integer representing the key length in bits; supported values are 128, 192, 256.
+// - format : hex, base64 or jwk (optional, defaults to hex)
 // Returns:
-// - random hex-encoded key (plain text)
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk
 func AESKey(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
@@ -68,20 +94,42 @@ func AESKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := generateKey(uint(keyLength / 8))
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("generateKey() can not generate key: %v", err.Error())
+	writeSymmetricKey(w, r, uint(keyLength/8))
+}
+
+// AESSIVKey - GET /aes-siv/key
+// Params:
+// - keyLength : non-negative integer representing the key length in bits; supported values are 256, 384, 512.
+// - format : hex, base64 or jwk (optional, defaults to hex)
+// Returns:
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk;
+//   the key is the concatenation of two AES keys of half the length
+func AESSIVKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyLengthValues, ok := r.Form["keyLength"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field keyLength"))
 		return
 	}
-	w.Write([]byte(result))
+
+	keyLength, err := strconv.Atoi(keyLengthValues[0])
+	if err != nil || (keyLength != 256 && keyLength != 384 && keyLength != 512) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyLength - supported values: 256, 384, 512"))
+		return
+	}
+
+	writeSymmetricKey(w, r, uint(keyLength/8))
 }
 
 // BlowfishKey - GET /blowfish/key
 // Params:
 // - keyLength : non-negative integer representing the key length in bits; supported values are {32 + 8k | 0 <= k <= 52}.
+// - format : hex, base64 or jwk (optional, defaults to hex)
 // Returns:
-// - random hex-encoded key (plain text)
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk
 func BlowfishKey(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
@@ -104,21 +152,111 @@ func BlowfishKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := generateKey(uint(keyLength / 8))
+	writeSymmetricKey(w, r, uint(keyLength/8))
+}
+
+// TwofishKey - GET /twofish/key
+// Params:
+// - keyLength : non-negative integer representing the key length in bits; supported values are 128, 192, 256.
+// - format : hex, base64 or jwk (optional, defaults to hex)
+// Returns:
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk
+func TwofishKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyLengthValues, ok := r.Form["keyLength"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field keyLength"))
+		return
+	}
+
+	keyLength, err := strconv.Atoi(keyLengthValues[0])
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("generateKey() can not generate key: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid field keyLength"))
+		return
+	}
+	if keyLength != 128 && keyLength != 192 && keyLength != 256 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyLength - supported values: 128, 192, 256"))
 		return
 	}
-	w.Write([]byte(result))
+
+	writeSymmetricKey(w, r, uint(keyLength/8))
 }
 
-// TwofishKey - GET /twofish/key
+// TripleDESKey - GET /3des/key
+// Params:
+// - keyLength : non-negative integer representing the key length in bits; supported values are 192.
+// - format : hex, base64 or jwk (optional, defaults to hex)
+// Returns:
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk
+// 3DES is a legacy cipher, so the response is marked as deprecated.
+func TripleDESKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyLengthValues, ok := r.Form["keyLength"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field keyLength"))
+		return
+	}
+
+	keyLength, err := strconv.Atoi(keyLengthValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid field keyLength"))
+		return
+	}
+	if keyLength != 192 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyLength - supported values: 192"))
+		return
+	}
+
+	writeLegacySymmetricKey(w, r, uint(keyLength/8), "3DES")
+}
+
+// CAST5Key - GET /cast5/key
+// Params:
+// - keyLength : non-negative integer representing the key length in bits; supported values are 128.
+// - format : hex, base64 or jwk (optional, defaults to hex)
+// Returns:
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk
+// CAST5 is a legacy cipher, so the response is marked as deprecated.
+func CAST5Key(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyLengthValues, ok := r.Form["keyLength"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field keyLength"))
+		return
+	}
+
+	keyLength, err := strconv.Atoi(keyLengthValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid field keyLength"))
+		return
+	}
+	if keyLength != 128 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyLength - supported values: 128"))
+		return
+	}
+
+	writeLegacySymmetricKey(w, r, uint(keyLength/8), "CAST5")
+}
+
+// CamelliaKey - GET /camellia/key
 // Params:
 // - keyLength : non-negative integer representing the key length in bits; supported values are 128, 192, 256.
+// - format : hex, base64 or jwk (optional, defaults to hex)
 // Returns:
-// - random hex-encoded key (plain text)
-func TwofishKey(w http.ResponseWriter, r *http.Request) {
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk
+func CamelliaKey(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
 	keyLengthValues, ok := r.Form["keyLength"]
@@ -140,13 +278,70 @@ func TwofishKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := generateKey(uint(keyLength / 8))
+	writeSymmetricKey(w, r, uint(keyLength/8))
+}
+
+// SM4Key - GET /sm4/key
+// Params:
+// - keyLength : non-negative integer representing the key length in bits; supported values are 128.
+// - format : hex, base64 or jwk (optional, defaults to hex)
+// Returns:
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk
+func SM4Key(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyLengthValues, ok := r.Form["keyLength"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field keyLength"))
+		return
+	}
+
+	keyLength, err := strconv.Atoi(keyLengthValues[0])
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("generateKey() can not generate key: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid field keyLength"))
 		return
 	}
-	w.Write([]byte(result))
+	if keyLength != 128 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyLength - supported values: 128"))
+		return
+	}
+
+	writeSymmetricKey(w, r, uint(keyLength/8))
+}
+
+// XTEAKey - GET /xtea/key
+// Params:
+// - keyLength : non-negative integer representing the key length in bits; supported values are 128.
+// - format : hex, base64 or jwk (optional, defaults to hex)
+// Returns:
+// - random key (plain text) in the requested format; a JSON Web Key of type oct for jwk
+// XTEA is a legacy cipher, so the response is marked as deprecated.
+func XTEAKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	keyLengthValues, ok := r.Form["keyLength"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field keyLength"))
+		return
+	}
+
+	keyLength, err := strconv.Atoi(keyLengthValues[0])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid field keyLength"))
+		return
+	}
+	if keyLength != 128 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyLength - supported values: 128"))
+		return
+	}
+
+	writeLegacySymmetricKey(w, r, uint(keyLength/8), "XTEA")
 }
 
 // Password - GET /password
@@ -156,7 +351,9 @@ func TwofishKey(w http.ResponseWriter, r *http.Request) {
 // - numeric : non-negative integer
 // - special : non-negative integer
 // Returns:
-// - random password (plain text)
+// - random password (plain text), with its strength score (0-4) in the X-Password-Strength-Score header
+//   and its estimated entropy in bits in the X-Password-Entropy header, both omitted for passwords
+//   longer than MAX_STRENGTH_PASSWORD_LENGTH characters
 func Password(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
@@ -211,86 +408,106 @@ func Password(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := GeneratePassword(uint(alphaLower), uint(alphaUpper), uint(numeric), uint(special))
-	w.Write([]byte(result))
-}
-
-func generateRSAKeys(bytesCount uint) ([]byte, []byte, error) {
-	// generate private key
-	pk, err := rsa.GenerateKey(crand.Reader, int(bytesCount*8))
-	if err != nil {
-		return nil, nil, err
-	}
-	err = pk.Validate()
+	result, err := GeneratePassword(uint(alphaLower), uint(alphaUpper), uint(numeric), uint(special))
 	if err != nil {
-		return nil, nil, err
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GeneratePassword() can not generate password: %v", err.Error())
+		return
 	}
+	writePassword(w, result)
+}
 
-	// output private key in ASN.1 DER format
-	privDER := x509.MarshalPKCS1PrivateKey(pk)
-	privBlock := pem.Block{
-		Type:    "RSA PRIVATE KEY",
-		Headers: nil,
-		Bytes:   privDER,
+// writePassword writes the password with its strength score and estimated entropy in headers,
+// passwords too long to score are written without them
+func writePassword(w http.ResponseWriter, password string) {
+	if utf8.RuneCountInString(password) <= MAX_STRENGTH_PASSWORD_LENGTH {
+		strength := EstimatePasswordStrength(password, nil)
+		w.Header().Set("X-Password-Strength-Score", strconv.Itoa(strength.Score))
+		w.Header().Set("X-Password-Entropy", strconv.FormatFloat(strength.Entropy, 'f', 2, 64))
 	}
-	privatePEM := pem.EncodeToMemory(&privBlock)
+	w.Write([]byte(password))
+}
 
-	// output public key in ASN.1 DER format
-	pubDER := x509.MarshalPKCS1PublicKey(&pk.PublicKey)
-	pubBlock := pem.Block{
-		Type:    "PUBLIC KEY",
-		Headers: nil,
-		Bytes:   pubDER,
-	}
-	publicPEM := pem.EncodeToMemory(&pubBlock)
+// MarkDeprecated flags the response as coming from a legacy algorithm which should not be used for new data
+func MarkDeprecated(w http.ResponseWriter, algorithm string) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Warning", "299 - \""+algorithm+" is a legacy algorithm, use it only for existing data\"")
+}
 
-	return privatePEM, publicPEM, nil
+// GenerateRSAKey generates and validates an RSA private key
+func GenerateRSAKey(bits int) (*rsa.PrivateKey, error) {
+	pk, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	if err = pk.Validate(); err != nil {
+		return nil, err
+	}
+	return pk, nil
 }
 
-func generateKey(bytesCount uint) (string, error) {
+// GenerateKey returns bytesCount random bytes from the cryptographically secure source
+func GenerateKey(bytesCount uint) ([]byte, error) {
 	key := make([]byte, bytesCount)
-	_, err := rand.Read(key)
+	_, err := io.ReadFull(rand.Reader, key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return hex.EncodeToString(key), nil
+	return key, nil
 }
 
 // GeneratePassword generates a random string given the character group counts
-func GeneratePassword(alphaLowerCount, alphaUpperCount, numericCount, specialCount uint) string {
-	alphaLower := "abcdefghijklmnopqrstuvwxyz"
-	alphaUpper := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	numeric := "0123456789"
-	special := " !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
-
+func GeneratePassword(alphaLowerCount, alphaUpperCount, numericCount, specialCount uint) (string, error) {
 	result := make([]byte, 0, alphaLowerCount+alphaUpperCount+numericCount+specialCount)
 
-	alphaLowerLength := len(alphaLower)
-	for i := uint(0); i < alphaLowerCount; i++ {
-		result = append(result, alphaLower[rand.Intn(alphaLowerLength)])
+	var err error
+	if result, err = appendRandomCharacters(result, alphaLowerCharacters, alphaLowerCount); err != nil {
+		return "", err
+	}
+	if result, err = appendRandomCharacters(result, alphaUpperCharacters, alphaUpperCount); err != nil {
+		return "", err
 	}
-	alphaUpperLength := len(alphaUpper)
-	for i := uint(0); i < alphaUpperCount; i++ {
-		result = append(result, alphaUpper[rand.Intn(alphaUpperLength)])
+	if result, err = appendRandomCharacters(result, numericCharacters, numericCount); err != nil {
+		return "", err
 	}
-	numericLength := len(numeric)
-	for i := uint(0); i < numericCount; i++ {
-		result = append(result, numeric[rand.Intn(numericLength)])
+	if result, err = appendRandomCharacters(result, specialCharacters, specialCount); err != nil {
+		return "", err
 	}
-	specialLength := len(special)
-	for i := uint(0); i < specialCount; i++ {
-		result = append(result, special[rand.Intn(specialLength)])
+
+	if err := permute(result); err != nil {
+		return "", err
 	}
+	return string(result), nil
+}
 
-	return permute(string(result))
+func appendRandomCharacters(result []byte, characters string, count uint) ([]byte, error) {
+	for i := uint(0); i < count; i++ {
+		index, err := randomIndex(len(characters))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, characters[index])
+	}
+	return result, nil
 }
 
-func permute(text string) string {
-	var buffer bytes.Buffer
-	for len(text) > 0 {
-		index := rand.Intn(len(text))
-		buffer.WriteByte(text[index])
-		text = text[:index] + text[index+1:]
+// permute shuffles the text in place (Fisher-Yates)
+func permute(text []byte) error {
+	for i := len(text) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return err
+		}
+		text[i], text[j] = text[j], text[i]
+	}
+	return nil
+}
+
+// randomIndex returns a uniformly distributed random integer in [0, n) from the cryptographically secure source
+func randomIndex(n int) (int, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
 	}
-	return buffer.String()
+	return int(index.Int64()), nil
 }
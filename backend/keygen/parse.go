@@ -0,0 +1,151 @@
+package keygen
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrEncryptedKey is returned when an encrypted private key is parsed without a passphrase
+var ErrEncryptedKey = errors.New("passphrase required for encrypted keys")
+
+// IsPassphraseError tells whether the private key could not be decrypted for a missing or incorrect passphrase
+func IsPassphraseError(err error) bool {
+	return err == ErrEncryptedKey || err == ErrIncorrectPassphrase
+}
+
+// ParsePrivateKey reads the first private key of the input, returning its format and the remaining PEM input:
+// PEM (PKCS #1, PKCS #8, encrypted PKCS #8, SEC 1, OpenSSH), base64 or hex DER (PKCS #1, PKCS #8, SEC 1) or JWK;
+// the passphrase decrypts encrypted PKCS #8 and OpenSSH keys
+func ParsePrivateKey(key, passphrase []byte) (crypto.Signer, string, []byte, error) {
+	trimmed := bytes.TrimSpace(key)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		jwk, err := ParseJSONWebKey(trimmed)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		signer, ok := jwk.(crypto.Signer)
+		if !ok {
+			return nil, "", nil, errors.New("not a private key")
+		}
+		return signer, "jwk", nil, nil
+	}
+
+	if block, _ := pem.Decode(key); block == nil {
+		der, ok := DecodeDER(trimmed)
+		if !ok {
+			return nil, "", nil, errors.New("can not decode key")
+		}
+		for _, format := range []string{"pkcs8", "pkcs1", "sec1"} {
+			if signer, err := parsePrivateKeyDER(der, format); err == nil {
+				return signer, format + "-der", nil, nil
+			}
+		}
+		if len(passphrase) > 0 {
+			signer, err := ParseEncryptedPKCS8PrivateKey(der, passphrase)
+			return signer, "pkcs8-der", nil, err
+		}
+		return nil, "", nil, errors.New("not a private key")
+	}
+
+	for rest := key; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, "", nil, errors.New("not a private key")
+		}
+		if block.Headers["Proc-Type"] != "" {
+			return nil, "", nil, errors.New("legacy PEM encryption is not supported")
+		}
+		var format string
+		switch block.Type {
+		case "ENCRYPTED PRIVATE KEY":
+			if len(passphrase) == 0 {
+				return nil, "", nil, ErrEncryptedKey
+			}
+			signer, err := ParseEncryptedPKCS8PrivateKey(block.Bytes, passphrase)
+			return signer, "pkcs8", rest, err
+		case "RSA PRIVATE KEY":
+			format = "pkcs1"
+		case "EC PRIVATE KEY":
+			format = "sec1"
+		case "PRIVATE KEY":
+			format = "pkcs8"
+		case "OPENSSH PRIVATE KEY":
+			signer, err := parseOpenSSHPrivateKey(pem.EncodeToMemory(block), passphrase)
+			return signer, "openssh", rest, err
+		default:
+			continue
+		}
+		signer, err := parsePrivateKeyDER(block.Bytes, format)
+		return signer, format, rest, err
+	}
+}
+
+// parsePrivateKeyDER parses a PKCS #1, PKCS #8 or SEC 1 private key
+func parsePrivateKeyDER(der []byte, format string) (crypto.Signer, error) {
+	switch format {
+	case "pkcs1":
+		return x509.ParsePKCS1PrivateKey(der)
+	case "sec1":
+		return x509.ParseECPrivateKey(der)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	return signer, nil
+}
+
+// parseOpenSSHPrivateKey parses an "OPENSSH PRIVATE KEY" PEM block, decrypting it with the passphrase if it is encrypted
+func parseOpenSSHPrivateKey(key, passphrase []byte) (crypto.Signer, error) {
+	raw, err := ssh.ParseRawPrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		if len(passphrase) == 0 {
+			return nil, ErrEncryptedKey
+		}
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase(key, passphrase)
+		if err == x509.IncorrectPasswordError {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := raw.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case *ed25519.PrivateKey:
+		return *k, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+// DecodeDER decodes base64 (standard or URL alphabet, whitespace is ignored) or hex DER input
+func DecodeDER(data []byte) ([]byte, bool) {
+	compact := string(bytes.Join(bytes.Fields(data), nil))
+	if der, err := hex.DecodeString(compact); err == nil && len(der) > 0 {
+		return der, true
+	}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if der, err := encoding.DecodeString(compact); err == nil && len(der) > 0 {
+			return der, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,143 @@
+package keygen
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_PASSPHRASE_WORDS = 6
+
+const MAX_PASSPHRASE_WORDS = 32
+
+const passphraseSymbols = "!#$%&*+-=?@^_~"
+
+// Passphrase - GET /passphrase
+// Params:
+// - words : positive integer, number of words (optional, defaults to 6, at most 32)
+// - wordList : large (EFF large list, 7776 words) or short (EFF short list, 1296 words) (optional, defaults to large)
+// - separator : string placed between words (optional, defaults to a single space)
+// - capitalization : none, first (first letter of every word), upper, or random (every word is capitalized or not at random) (optional, defaults to none)
+// - number : true to append a random digit to a random word (optional)
+// - symbol : true to append a random symbol to a random word (optional)
+// Returns:
+// - passphrase and its entropy in bits in JSON format:
+//   "passphrase": string,
+//   "entropy": number
+func Passphrase(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	incorrect := make([]string, 0, 3)
+	words := DEFAULT_PASSPHRASE_WORDS
+	if wordsValues, ok := r.Form["words"]; ok {
+		wordsParam, err := strconv.Atoi(wordsValues[0])
+		if err != nil || wordsParam <= 0 || wordsParam > MAX_PASSPHRASE_WORDS {
+			incorrect = append(incorrect, "words")
+		}
+		words = wordsParam
+	}
+	wordList := effLargeWordList
+	if wordListValues, ok := r.Form["wordList"]; ok {
+		switch wordListValues[0] {
+		case "large":
+		case "short":
+			wordList = effShortWordList
+		default:
+			incorrect = append(incorrect, "wordList")
+		}
+	}
+	separator := " "
+	if separatorValues, ok := r.Form["separator"]; ok {
+		separator = separatorValues[0]
+	}
+	capitalization := "none"
+	if capitalizationValues, ok := r.Form["capitalization"]; ok {
+		capitalization = capitalizationValues[0]
+		if capitalization != "none" && capitalization != "first" && capitalization != "upper" && capitalization != "random" {
+			incorrect = append(incorrect, "capitalization")
+		}
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	passphrase, entropy, err := generatePassphrase(wordList, words, separator, capitalization, r.Form.Get("number") == "true", r.Form.Get("symbol") == "true")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("generatePassphrase() can not generate passphrase: %v", err.Error())
+		return
+	}
+
+	result := struct {
+		Passphrase string  `json:"passphrase"`
+		Entropy    float64 `json:"entropy"`
+	}{
+		Passphrase: passphrase,
+		Entropy:    math.Round(entropy*100) / 100,
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize passphrase to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// generatePassphrase picks random words from the list and returns the passphrase with its entropy in bits
+func generatePassphrase(wordList []string, count int, separator, capitalization string, number, symbol bool) (string, float64, error) {
+	words := make([]string, count)
+	entropy := float64(count) * math.Log2(float64(len(wordList)))
+	for i := range words {
+		index, err := randomIndex(len(wordList))
+		if err != nil {
+			return "", 0, err
+		}
+		words[i] = wordList[index]
+
+		switch capitalization {
+		case "first":
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		case "upper":
+			words[i] = strings.ToUpper(words[i])
+		case "random":
+			capitalize, err := randomIndex(2)
+			if err != nil {
+				return "", 0, err
+			}
+			if capitalize == 1 {
+				words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+			}
+			entropy++
+		}
+	}
+
+	// extra characters are appended to a random word, adding the entropy of the character and the position
+	extras := make([]string, 0, 2)
+	if number {
+		extras = append(extras, "0123456789")
+	}
+	if symbol {
+		extras = append(extras, passphraseSymbols)
+	}
+	for _, characters := range extras {
+		characterIndex, err := randomIndex(len(characters))
+		if err != nil {
+			return "", 0, err
+		}
+		wordIndex, err := randomIndex(count)
+		if err != nil {
+			return "", 0, err
+		}
+		words[wordIndex] += characters[characterIndex : characterIndex+1]
+		entropy += math.Log2(float64(len(characters))) + math.Log2(float64(count))
+	}
+
+	return strings.Join(words, separator), entropy, nil
+}
@@ -0,0 +1,243 @@
+package keygen
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const PKCS8_PBKDF2_ITERATIONS = 600000
+
+// MAX_PKCS8_PBKDF2_ITERATIONS bounds the work spent on decrypting keys from elsewhere
+const MAX_PKCS8_PBKDF2_ITERATIONS = 2000000
+
+// PKCS8_SCRYPT_COST is the OpenSSL default, which keeps scrypt within the 32 MiB OpenSSL memory limit
+const PKCS8_SCRYPT_COST = 16384
+
+// MAX_PKCS8_SCRYPT_COST bounds the memory spent on decrypting keys from elsewhere, 64 MiB with a block size of 8
+// like the memory limit of /kdf
+const MAX_PKCS8_SCRYPT_COST = 1 << 16
+
+// MAX_PKCS8_SCRYPT_BLOCK_SIZE is the scrypt block size used by OpenSSL and most other implementations
+const MAX_PKCS8_SCRYPT_BLOCK_SIZE = 8
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// ErrIncorrectPassphrase is returned when an encrypted private key can not be decrypted with the passphrase
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// PKCS8KDFs are the supported PBES2 key derivation functions
+var PKCS8KDFs = []string{"scrypt", "pbkdf2"}
+
+// encryptedPrivateKeyInfo is the PKCS #8 EncryptedPrivateKeyInfo structure (RFC 5208)
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the PBES2 parameters (RFC 8018)
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the PBKDF2 parameters (RFC 8018), the PRF defaults to HMAC-SHA1 if it is omitted
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// scryptParams are the scrypt parameters (RFC 7914)
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// MarshalEncryptedPKCS8PrivateKey encrypts the private key as a PKCS #8 EncryptedPrivateKeyInfo,
+// using PBES2 with AES-256-CBC and a key derived from the passphrase with scrypt or PBKDF2-HMAC-SHA256
+func MarshalEncryptedPKCS8PrivateKey(key crypto.Signer, passphrase []byte, kdf string) ([]byte, error) {
+	plaintext, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := GenerateKey(16)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := GenerateKey(aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var derivedKey []byte
+	var kdfAlgorithm pkix.AlgorithmIdentifier
+	switch kdf {
+	case "scrypt":
+		params := scryptParams{Salt: salt, CostParameter: PKCS8_SCRYPT_COST, BlockSize: 8, ParallelizationParameter: 1}
+		if derivedKey, err = scrypt.Key(passphrase, salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, 32); err != nil {
+			return nil, err
+		}
+		kdfAlgorithm.Algorithm = oidScrypt
+		kdfAlgorithm.Parameters.FullBytes, err = asn1.Marshal(params)
+	case "pbkdf2":
+		params := pbkdf2Params{
+			Salt:           salt,
+			IterationCount: PKCS8_PBKDF2_ITERATIONS,
+			PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+		}
+		derivedKey = pbkdf2.Key(passphrase, salt, params.IterationCount, 32, sha256.New)
+		kdfAlgorithm.Algorithm = oidPBKDF2
+		kdfAlgorithm.Parameters.FullBytes, err = asn1.Marshal(params)
+	default:
+		return nil, errors.New("unsupported key derivation function " + kdf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext := append(plaintext, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	encryptionScheme := pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC}
+	if encryptionScheme.Parameters.FullBytes, err = asn1.Marshal(iv); err != nil {
+		return nil, err
+	}
+	pbes2, err := asn1.Marshal(pbes2Params{KeyDerivationFunc: kdfAlgorithm, EncryptionScheme: encryptionScheme})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: pbes2}},
+		EncryptedData: ciphertext,
+	})
+}
+
+// ParseEncryptedPKCS8PrivateKey decrypts a PKCS #8 EncryptedPrivateKeyInfo using PBES2 with AES-CBC
+// and a key derived with scrypt or PBKDF2, as written by MarshalEncryptedPKCS8PrivateKey or OpenSSL
+func ParseEncryptedPKCS8PrivateKey(der, passphrase []byte) (crypto.Signer, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errors.New("invalid encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("unsupported encryption scheme, only PBES2 is supported")
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+
+	var keyLength int
+	switch algorithm := params.EncryptionScheme.Algorithm; {
+	case algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, errors.New("unsupported cipher, only AES-CBC is supported")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid initialization vector")
+	}
+	derivedKey, err := derivePBES2Key(params.KeyDerivationFunc, passphrase, keyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := info.EncryptedData
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted data length")
+	}
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	key, err := x509.ParsePKCS8PrivateKey(plaintext[:len(plaintext)-padding])
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	return signer, nil
+}
+
+// derivePBES2Key derives the encryption key with scrypt or PBKDF2, within the memory and iteration limits
+func derivePBES2Key(kdf pkix.AlgorithmIdentifier, passphrase []byte, keyLength int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		n, r, p := params.CostParameter, params.BlockSize, params.ParallelizationParameter
+		if n < 2 || n > MAX_PKCS8_SCRYPT_COST || r < 1 || r > MAX_PKCS8_SCRYPT_BLOCK_SIZE || p != 1 {
+			return nil, errors.New("unsupported scrypt parameters")
+		}
+		return scrypt.Key(passphrase, params.Salt, n, r, p, keyLength)
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if params.IterationCount < 1 || params.IterationCount > MAX_PKCS8_PBKDF2_ITERATIONS {
+			return nil, errors.New("unsupported PBKDF2 iteration count")
+		}
+		prf := sha1.New
+		switch algorithm := params.PRF.Algorithm; {
+		case len(algorithm) == 0 || algorithm.Equal(oidHMACWithSHA1):
+		case algorithm.Equal(oidHMACWithSHA256):
+			prf = sha256.New
+		case algorithm.Equal(oidHMACWithSHA384):
+			prf = sha512.New384
+		case algorithm.Equal(oidHMACWithSHA512):
+			prf = sha512.New
+		default:
+			return nil, errors.New("unsupported PBKDF2 pseudorandom function")
+		}
+		return pbkdf2.Key(passphrase, params.Salt, params.IterationCount, keyLength, prf), nil
+	}
+	return nil, errors.New("unsupported key derivation function, only scrypt and PBKDF2 are supported")
+}
@@ -0,0 +1,569 @@
+package keygen
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_POLICY_PASSWORD_LENGTH = 16
+
+const MAX_POLICY_PASSWORD_LENGTH = 256
+
+const MAX_TEMPLATE_LENGTH = 256
+
+// look-alike characters removed when similar characters are excluded
+const similarCharacters = "0Oo1lI|"
+
+const vowelCharacters = "aeiou"
+
+const consonantCharacters = "bcdfghjklmnpqrstvwxyz"
+
+// PasswordPolicy describes the character composition of generated passwords
+type PasswordPolicy struct {
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	Length            int    `json:"length"`
+	Lowercase         bool   `json:"lowercase"`
+	Uppercase         bool   `json:"uppercase"`
+	Numeric           bool   `json:"numeric"`
+	Special           bool   `json:"special"`
+	MinLowercase      int    `json:"minLowercase"`
+	MinUppercase      int    `json:"minUppercase"`
+	MinNumeric        int    `json:"minNumeric"`
+	MinSpecial        int    `json:"minSpecial"`
+	SpecialCharacters string `json:"specialCharacters"`
+	Characters        string `json:"characters,omitempty"`
+	ExcludeSimilar    bool   `json:"excludeSimilar"`
+	NoRepeat          bool   `json:"noRepeat"`
+}
+
+var passwordPolicyPresets = []PasswordPolicy{
+	{
+		Name:              "aws-iam",
+		Description:       "AWS IAM user password policy: upper and lower case letters, numbers and the symbols allowed by IAM",
+		Length:            20,
+		Lowercase:         true,
+		Uppercase:         true,
+		Numeric:           true,
+		Special:           true,
+		MinLowercase:      1,
+		MinUppercase:      1,
+		MinNumeric:        1,
+		MinSpecial:        1,
+		SpecialCharacters: "!@#$%^&*()_+-=[]{}|'",
+	},
+	{
+		Name:              "active-directory",
+		Description:       "Active Directory password complexity requirements: characters from all four categories",
+		Length:            16,
+		Lowercase:         true,
+		Uppercase:         true,
+		Numeric:           true,
+		Special:           true,
+		MinLowercase:      1,
+		MinUppercase:      1,
+		MinNumeric:        1,
+		MinSpecial:        1,
+		SpecialCharacters: "~!@#$%^&*_-+=`|\\(){}[]:;\"'<>,.?/",
+	},
+	{
+		Name:              "wifi",
+		Description:       "WPA2/WPA3 passphrase which is easy to type on other devices: letters and numbers without look-alike characters",
+		Length:            20,
+		Lowercase:         true,
+		Uppercase:         true,
+		Numeric:           true,
+		MinLowercase:      1,
+		MinUppercase:      1,
+		MinNumeric:        1,
+		SpecialCharacters: specialCharacters,
+		ExcludeSimilar:    true,
+	},
+	{
+		Name:              "pin",
+		Description:       "Numeric PIN without repeated digits",
+		Length:            6,
+		Numeric:           true,
+		SpecialCharacters: specialCharacters,
+		NoRepeat:          true,
+	},
+}
+
+// characterClass is a set of characters of which at least min are used
+type characterClass struct {
+	name       string
+	characters string
+	min        int
+}
+
+// PolicyPassword - GET /password/policy
+// Params:
+// - preset : name of a policy preset listed by /password/presets, the other params override its settings (optional)
+// - length : positive integer (optional, defaults to 16, at most 256)
+// - lowercase, uppercase, numeric, special : true or false, use the character class (optional, defaults to true without a preset)
+// - minLowercase, minUppercase, minNumeric, minSpecial : non-negative integer, minimum count of the character class (optional)
+// - specialCharacters : printable ASCII characters used as the special class (optional)
+// - characters : printable ASCII characters, custom character set which replaces the character classes (optional)
+// - excludeSimilar : true to exclude look-alike characters 0, O, o, 1, l, I and | (optional)
+// - noRepeat : true to use every character at most once (optional)
+// Returns:
+// - random password (plain text), with its strength score and entropy in headers like /password
+func PolicyPassword(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	policy := PasswordPolicy{
+		Length:            DEFAULT_POLICY_PASSWORD_LENGTH,
+		Lowercase:         true,
+		Uppercase:         true,
+		Numeric:           true,
+		Special:           true,
+		SpecialCharacters: specialCharacters,
+	}
+	if presetValues, ok := r.Form["preset"]; ok {
+		preset, ok := findPasswordPolicyPreset(presetValues[0])
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("unknown preset"))
+			return
+		}
+		policy = preset
+	}
+
+	incorrect := make([]string, 0, 4)
+	parseInt := func(name string, value *int) {
+		if values, ok := r.Form[name]; ok {
+			parsed, err := strconv.Atoi(values[0])
+			if err != nil || parsed < 0 {
+				incorrect = append(incorrect, name)
+			}
+			*value = parsed
+		}
+	}
+	parseBool := func(name string, value *bool) {
+		if values, ok := r.Form[name]; ok {
+			parsed, err := strconv.ParseBool(values[0])
+			if err != nil {
+				incorrect = append(incorrect, name)
+			}
+			*value = parsed
+		}
+	}
+	parseInt("length", &policy.Length)
+	parseBool("lowercase", &policy.Lowercase)
+	parseBool("uppercase", &policy.Uppercase)
+	parseBool("numeric", &policy.Numeric)
+	parseBool("special", &policy.Special)
+	parseInt("minLowercase", &policy.MinLowercase)
+	parseInt("minUppercase", &policy.MinUppercase)
+	parseInt("minNumeric", &policy.MinNumeric)
+	parseInt("minSpecial", &policy.MinSpecial)
+	parseBool("excludeSimilar", &policy.ExcludeSimilar)
+	parseBool("noRepeat", &policy.NoRepeat)
+	if specialValues, ok := r.Form["specialCharacters"]; ok {
+		policy.SpecialCharacters = specialValues[0]
+	}
+	if charactersValues, ok := r.Form["characters"]; ok {
+		policy.Characters = charactersValues[0]
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+	if err := policy.Validate(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	result, err := GeneratePolicyPassword(policy)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GeneratePolicyPassword() can not generate password: %v", err.Error())
+		return
+	}
+	writePassword(w, result)
+}
+
+// PasswordPresets - GET /password/presets
+// Returns:
+// - policy presets usable with /password/policy in JSON format:
+//   [ { "name": string, "description": string, "length": integer, "lowercase": boolean, "uppercase": boolean,
+//   "numeric": boolean, "special": boolean, "minLowercase": integer, "minUppercase": integer, "minNumeric": integer,
+//   "minSpecial": integer, "specialCharacters": string, "excludeSimilar": boolean, "noRepeat": boolean }, ... ]
+func PasswordPresets(w http.ResponseWriter, r *http.Request) {
+	json, err := json.Marshal(passwordPolicyPresets)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize password presets to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// TemplatePassword - GET /password/template
+// Params:
+// - template : pattern of up to 256 characters, e.g. Cvccvc-99-!!, where
+//   c is a lower case consonant, C an upper case consonant, v a lower case vowel, V an upper case vowel,
+//   a a lower case letter, A an upper case letter, 9 a digit, ! a special character, x any of these characters,
+//   \ makes the next character literal and every other character is used as is
+// - excludeSimilar : true to exclude look-alike characters 0, O, o, 1, l, I and | (optional)
+// Returns:
+// - random password (plain text), with its strength score and entropy in headers like /password
+func TemplatePassword(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	templateValues, ok := r.Form["template"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field template"))
+		return
+	}
+	excludeSimilar := false
+	if excludeSimilarValues, ok := r.Form["excludeSimilar"]; ok {
+		var err error
+		if excludeSimilar, err = strconv.ParseBool(excludeSimilarValues[0]); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("incorrect fields: excludeSimilar"))
+			return
+		}
+	}
+
+	positions, err := parsePasswordTemplate(templateValues[0], excludeSimilar)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	result := make([]byte, 0, len(positions))
+	for _, characters := range positions {
+		if result, err = appendRandomCharacters(result, characters, 1); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("appendRandomCharacters() can not generate password: %v", err.Error())
+			return
+		}
+	}
+	writePassword(w, string(result))
+}
+
+// Validate checks that passwords satisfying the policy exist
+func (policy PasswordPolicy) Validate() error {
+	if policy.Length <= 0 || policy.Length > MAX_POLICY_PASSWORD_LENGTH {
+		return errors.New("length must be between 1 and " + strconv.Itoa(MAX_POLICY_PASSWORD_LENGTH))
+	}
+	if !isPrintableASCII(policy.SpecialCharacters) || !isPrintableASCII(policy.Characters) {
+		return errors.New("characters must be printable ASCII characters")
+	}
+	// bounding every minimum count before they are summed keeps the sums from overflowing
+	for _, min := range []int{policy.MinLowercase, policy.MinUppercase, policy.MinNumeric, policy.MinSpecial} {
+		if min < 0 || min > policy.Length {
+			return errors.New("minimum counts must be between 0 and the password length")
+		}
+	}
+	if policy.Characters != "" && policy.MinLowercase+policy.MinUppercase+policy.MinNumeric+policy.MinSpecial > 0 {
+		return errors.New("minimum counts can not be combined with a custom character set")
+	}
+	if (!policy.Lowercase && policy.MinLowercase > 0) || (!policy.Uppercase && policy.MinUppercase > 0) ||
+		(!policy.Numeric && policy.MinNumeric > 0) || (!policy.Special && policy.MinSpecial > 0) {
+		return errors.New("minimum count set for an unused character class")
+	}
+
+	classes := policy.characterClasses()
+	minTotal := 0
+	for _, class := range classes {
+		if len(class.characters) == 0 {
+			return errors.New("character class " + class.name + " is empty")
+		}
+		minTotal += class.min
+	}
+	if policy.NoRepeat {
+		if err := validateDistinctMinimums(classes); err != nil {
+			return err
+		}
+	}
+	if len(classes) == 0 {
+		return errors.New("no characters to generate the password from")
+	}
+	if minTotal > policy.Length {
+		return errors.New("minimum counts exceed the password length")
+	}
+	if policy.NoRepeat && len(joinCharacterClasses(classes)) < policy.Length {
+		return errors.New("too few characters for the password length without repeated characters")
+	}
+	return nil
+}
+
+// GeneratePolicyPassword generates a random password satisfying the policy
+func GeneratePolicyPassword(policy PasswordPolicy) (string, error) {
+	if err := policy.Validate(); err != nil {
+		return "", err
+	}
+
+	classes := policy.characterClasses()
+	var used map[byte]bool
+	if policy.NoRepeat {
+		used = make(map[byte]bool, policy.Length)
+	}
+
+	result := make([]byte, 0, policy.Length)
+	if policy.NoRepeat {
+		distinct, err := pickDistinctCharacters(classes, used)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, distinct...)
+	} else {
+		for _, class := range classes {
+			for i := 0; i < class.min; i++ {
+				character, err := pickCharacter(class.characters, nil)
+				if err != nil {
+					return "", err
+				}
+				result = append(result, character)
+			}
+		}
+	}
+	all := joinCharacterClasses(classes)
+	for len(result) < policy.Length {
+		character, err := pickCharacter(all, used)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, character)
+	}
+
+	if err := permute(result); err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+func findPasswordPolicyPreset(name string) (PasswordPolicy, bool) {
+	for _, preset := range passwordPolicyPresets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return PasswordPolicy{}, false
+}
+
+func (policy PasswordPolicy) characterClasses() []characterClass {
+	classes := make([]characterClass, 0, 4)
+	if policy.Characters != "" {
+		classes = append(classes, characterClass{"characters", policy.Characters, 0})
+	} else {
+		if policy.Lowercase {
+			classes = append(classes, characterClass{"lowercase", alphaLowerCharacters, policy.MinLowercase})
+		}
+		if policy.Uppercase {
+			classes = append(classes, characterClass{"uppercase", alphaUpperCharacters, policy.MinUppercase})
+		}
+		if policy.Numeric {
+			classes = append(classes, characterClass{"numeric", numericCharacters, policy.MinNumeric})
+		}
+		if policy.Special {
+			classes = append(classes, characterClass{"special", policy.SpecialCharacters, policy.MinSpecial})
+		}
+	}
+
+	for i := range classes {
+		classes[i].characters = uniqueCharacters(classes[i].characters, policy.ExcludeSimilar)
+	}
+	return classes
+}
+
+// validateDistinctMinimums checks that the minimum counts can be met without repeated characters: every set of
+// classes, which may share custom special characters, needs at least as many characters as its minimum counts
+func validateDistinctMinimums(classes []characterClass) error {
+	for _, class := range classes {
+		if class.min < 0 || class.min > len(class.characters) {
+			return errors.New("character class " + class.name + " is too small for its minimum count without repeated characters")
+		}
+	}
+	for subset := 1; subset < 1<<uint(len(classes)); subset++ {
+		selected := make([]characterClass, 0, len(classes))
+		names := make([]string, 0, len(classes))
+		minTotal := 0
+		for i, class := range classes {
+			if subset&(1<<uint(i)) != 0 {
+				selected = append(selected, class)
+				names = append(names, class.name)
+				minTotal += class.min
+			}
+		}
+		if minTotal <= len(joinCharacterClasses(selected)) {
+			continue
+		}
+		if len(selected) == 1 {
+			return errors.New("character class " + names[0] + " is too small for its minimum count without repeated characters")
+		}
+		return errors.New("character classes " + strings.Join(names, ", ") + " share too few characters for their minimum counts without repeated characters")
+	}
+	return nil
+}
+
+// pickDistinctCharacters picks the minimum count of distinct characters for every class and marks them as used;
+// a character taken by one class is handed over along an augmenting path when another class needs it,
+// so that classes sharing characters do not run out of them
+func pickDistinctCharacters(classes []characterClass, used map[byte]bool) ([]byte, error) {
+	slots := make([]string, 0, MAX_POLICY_PASSWORD_LENGTH)
+	for _, class := range classes {
+		for i := 0; i < class.min; i++ {
+			slots = append(slots, class.characters)
+		}
+	}
+
+	owners := make(map[byte]int, len(slots))
+	var assign func(slot int, visited map[byte]bool) (bool, error)
+	assign = func(slot int, visited map[byte]bool) (bool, error) {
+		candidates := []byte(slots[slot])
+		if err := permute(candidates); err != nil {
+			return false, err
+		}
+		for _, character := range candidates {
+			if visited[character] {
+				continue
+			}
+			visited[character] = true
+			owner, taken := owners[character]
+			if taken {
+				assigned, err := assign(owner, visited)
+				if err != nil {
+					return false, err
+				}
+				if !assigned {
+					continue
+				}
+			}
+			owners[character] = slot
+			return true, nil
+		}
+		return false, nil
+	}
+	for slot := range slots {
+		assigned, err := assign(slot, make(map[byte]bool))
+		if err != nil {
+			return nil, err
+		}
+		if !assigned {
+			return nil, errors.New("no unused characters left")
+		}
+	}
+
+	result := make([]byte, 0, len(slots))
+	for character := range owners {
+		used[character] = true
+		result = append(result, character)
+	}
+	return result, nil
+}
+
+// joinCharacterClasses returns the characters of all classes, each character once
+func joinCharacterClasses(classes []characterClass) string {
+	var all strings.Builder
+	for _, class := range classes {
+		all.WriteString(class.characters)
+	}
+	return uniqueCharacters(all.String(), false)
+}
+
+// uniqueCharacters removes duplicate and, optionally, look-alike characters
+func uniqueCharacters(characters string, excludeSimilar bool) string {
+	seen := make(map[byte]bool, len(characters))
+	result := make([]byte, 0, len(characters))
+	for i := 0; i < len(characters); i++ {
+		if seen[characters[i]] || (excludeSimilar && strings.IndexByte(similarCharacters, characters[i]) >= 0) {
+			continue
+		}
+		seen[characters[i]] = true
+		result = append(result, characters[i])
+	}
+	return string(result)
+}
+
+// pickCharacter returns a random character; when used is not nil, only unused characters are picked and marked as used
+func pickCharacter(characters string, used map[byte]bool) (byte, error) {
+	available := []byte(characters)
+	if used != nil {
+		available = available[:0:0]
+		for i := 0; i < len(characters); i++ {
+			if !used[characters[i]] {
+				available = append(available, characters[i])
+			}
+		}
+		if len(available) == 0 {
+			return 0, errors.New("no unused characters left")
+		}
+	}
+
+	index, err := randomIndex(len(available))
+	if err != nil {
+		return 0, err
+	}
+	if used != nil {
+		used[available[index]] = true
+	}
+	return available[index], nil
+}
+
+// parsePasswordTemplate returns the characters to pick from for every position of the template
+func parsePasswordTemplate(template string, excludeSimilar bool) ([]string, error) {
+	if len(template) == 0 || len(template) > MAX_TEMPLATE_LENGTH {
+		return nil, errors.New("template must have between 1 and " + strconv.Itoa(MAX_TEMPLATE_LENGTH) + " characters")
+	}
+	if !isPrintableASCII(template) {
+		return nil, errors.New("template must consist of printable ASCII characters")
+	}
+
+	positions := make([]string, 0, len(template))
+	for i := 0; i < len(template); i++ {
+		var characters string
+		switch template[i] {
+		case 'c':
+			characters = consonantCharacters
+		case 'C':
+			characters = strings.ToUpper(consonantCharacters)
+		case 'v':
+			characters = vowelCharacters
+		case 'V':
+			characters = strings.ToUpper(vowelCharacters)
+		case 'a':
+			characters = alphaLowerCharacters
+		case 'A':
+			characters = alphaUpperCharacters
+		case '9':
+			characters = numericCharacters
+		case '!':
+			characters = specialCharacters
+		case 'x':
+			characters = alphaLowerCharacters + alphaUpperCharacters + numericCharacters + specialCharacters
+		case '\\':
+			i++
+			if i == len(template) {
+				return nil, errors.New("template ends with an unescaped \\")
+			}
+			positions = append(positions, template[i:i+1])
+			continue
+		default:
+			positions = append(positions, template[i:i+1])
+			continue
+		}
+		positions = append(positions, uniqueCharacters(characters, excludeSimilar))
+	}
+	return positions, nil
+}
+
+func isPrintableASCII(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] < ' ' || text[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package keygen
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rsaKeyPool holds pre-generated RSA keys of one size
+type rsaKeyPool struct {
+	bits   int
+	keys   chan *rsa.PrivateKey
+	hits   uint64
+	misses uint64
+}
+
+var rsaKeyPools = make(map[int]*rsaKeyPool)
+
+var rsaKeyPoolsMutex sync.RWMutex
+
+// StartRSAKeyPool keeps up to capacity fresh keys of the given size ready, refilled by a background worker
+func StartRSAKeyPool(bits, capacity int) error {
+	if bits != 1024 && bits != 2048 && bits != 3072 && bits != 4096 {
+		return errors.New("invalid RSA key pool size - supported values: 1024, 2048, 3072, 4096")
+	}
+	if capacity <= 0 {
+		return errors.New("RSA key pool capacity must be positive")
+	}
+
+	rsaKeyPoolsMutex.Lock()
+	defer rsaKeyPoolsMutex.Unlock()
+	if _, ok := rsaKeyPools[bits]; ok {
+		return errors.New("RSA key pool already started")
+	}
+	pool := &rsaKeyPool{bits: bits, keys: make(chan *rsa.PrivateKey, capacity)}
+	rsaKeyPools[bits] = pool
+
+	go func() {
+		for {
+			key, err := GenerateRSAKey(bits)
+			if err != nil {
+				log.Printf("can not generate %v-bit RSA key for the pool: %v", bits, err)
+				time.Sleep(time.Second)
+				continue
+			}
+			// blocks while the pool is full
+			pool.keys <- key
+		}
+	}()
+	return nil
+}
+
+// TakeRSAKey returns a key from the pool of its size, or generates it if the pool is empty or not started
+func TakeRSAKey(bits int) (*rsa.PrivateKey, error) {
+	rsaKeyPoolsMutex.RLock()
+	pool, ok := rsaKeyPools[bits]
+	rsaKeyPoolsMutex.RUnlock()
+	if ok {
+		select {
+		case key := <-pool.keys:
+			atomic.AddUint64(&pool.hits, 1)
+			return key, nil
+		default:
+			atomic.AddUint64(&pool.misses, 1)
+		}
+	}
+	return GenerateRSAKey(bits)
+}
+
+// RSAKeyPoolStatus - GET /rsa/key/pool
+// Returns:
+// - status of the started RSA key pools in JSON format, ordered by key length:
+//   [ { "keyLength": integer, "capacity": integer, "depth": integer, number of keys ready,
+//   "hits": integer, keys served from the pool, "misses": integer, keys generated on demand as the pool was empty }, ... ]
+func RSAKeyPoolStatus(w http.ResponseWriter, r *http.Request) {
+	type poolStatus struct {
+		KeyLength int    `json:"keyLength"`
+		Capacity  int    `json:"capacity"`
+		Depth     int    `json:"depth"`
+		Hits      uint64 `json:"hits"`
+		Misses    uint64 `json:"misses"`
+	}
+
+	rsaKeyPoolsMutex.RLock()
+	status := make([]poolStatus, 0, len(rsaKeyPools))
+	for _, pool := range rsaKeyPools {
+		status = append(status, poolStatus{
+			KeyLength: pool.bits,
+			Capacity:  cap(pool.keys),
+			Depth:     len(pool.keys),
+			Hits:      atomic.LoadUint64(&pool.hits),
+			Misses:    atomic.LoadUint64(&pool.misses),
+		})
+	}
+	rsaKeyPoolsMutex.RUnlock()
+	sort.Slice(status, func(i, j int) bool { return status[i].KeyLength < status[j].KeyLength })
+
+	json, err := json.Marshal(status)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize RSA key pool status to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
@@ -0,0 +1,141 @@
+package keygen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const MAX_SSH_COMMENT_LENGTH = 255
+
+// SSHKey - GET /ssh/key, POST /ssh/key
+// Params:
+// - keyType : ed25519, ecdsa or rsa (optional, defaults to ed25519)
+// - keyLength : RSA key length in bits; supported values are 2048, 3072, 4096 (optional, defaults to 3072)
+// - curve : ECDSA curve, P-256, P-384 or P-521 (optional, defaults to P-256)
+// - comment : key comment, e.g. user@host (optional)
+// - passphrase : passphrase to encrypt the private key with; read from the POST body only
+//   so that it does not end up in logs (optional, defaults to an unencrypted key)
+// Returns:
+// - key pair in JSON format:
+//   "privateKey": string, OpenSSH PEM format ("OPENSSH PRIVATE KEY"),
+//   "publicKey": string, authorized_keys format,
+//   "fingerprintMD5": string, e.g. "MD5:16:27:ac:...",
+//   "fingerprintSHA256": string, e.g. "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"
+func SSHKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	incorrect := make([]string, 0, 4)
+	keyType := "ed25519"
+	if keyTypeValues, ok := r.Form["keyType"]; ok {
+		keyType = keyTypeValues[0]
+		if keyType != "ed25519" && keyType != "ecdsa" && keyType != "rsa" {
+			incorrect = append(incorrect, "keyType")
+		}
+	}
+	keyLength := 3072
+	if keyLengthValues, ok := r.Form["keyLength"]; ok {
+		var err error
+		keyLength, err = strconv.Atoi(keyLengthValues[0])
+		if err != nil || (keyLength != 2048 && keyLength != 3072 && keyLength != 4096) {
+			incorrect = append(incorrect, "keyLength")
+		}
+	}
+	curve := "P-256"
+	if curveValues, ok := r.Form["curve"]; ok {
+		curve = curveValues[0]
+		if parseCurve(curve) == nil {
+			incorrect = append(incorrect, "curve")
+		}
+	}
+	comment := r.Form.Get("comment")
+	if passphraseInQuery(r) {
+		incorrect = append(incorrect, "passphrase")
+	}
+	if len(comment) > MAX_SSH_COMMENT_LENGTH || strings.ContainsAny(comment, "\r\n") {
+		incorrect = append(incorrect, "comment")
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	var privateKey crypto.Signer
+	var err error
+	switch keyType {
+	case "rsa":
+		privateKey, err = TakeRSAKey(keyLength)
+	case "ecdsa":
+		privateKey, err = ecdsa.GenerateKey(parseCurve(curve), rand.Reader)
+	default:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not generate %v key: %v", keyType, err.Error())
+		return
+	}
+
+	var privateBlock *pem.Block
+	if passphrase := r.PostForm.Get("passphrase"); passphrase != "" {
+		privateBlock, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, comment, []byte(passphrase))
+	} else {
+		privateBlock, err = ssh.MarshalPrivateKey(privateKey, comment)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not encode private key: %v", err.Error())
+		return
+	}
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not encode public key: %v", err.Error())
+		return
+	}
+
+	result := struct {
+		PrivateKey        string `json:"privateKey"`
+		PublicKey         string `json:"publicKey"`
+		FingerprintMD5    string `json:"fingerprintMD5"`
+		FingerprintSHA256 string `json:"fingerprintSHA256"`
+	}{
+		PrivateKey:        string(pem.EncodeToMemory(privateBlock)),
+		PublicKey:         authorizedKey(publicKey, comment),
+		FingerprintMD5:    "MD5:" + ssh.FingerprintLegacyMD5(publicKey),
+		FingerprintSHA256: ssh.FingerprintSHA256(publicKey),
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize key to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// authorizedKey formats the public key as an authorized_keys line, with the comment if it is set
+func authorizedKey(publicKey ssh.PublicKey, comment string) string {
+	line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(publicKey)), "\n")
+	if comment != "" {
+		line += " " + comment
+	}
+	return line + "\n"
+}
+
+// passphraseInQuery reports whether a passphrase was sent in the URL, where it would end up in logs
+func passphraseInQuery(r *http.Request) bool {
+	_, ok := r.URL.Query()["passphrase"]
+	return ok
+}
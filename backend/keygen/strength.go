@@ -0,0 +1,254 @@
+package keygen
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nbutton23/zxcvbn-go"
+	"github.com/nbutton23/zxcvbn-go/match"
+)
+
+// MAX_STRENGTH_PASSWORD_LENGTH caps the characters scored by zxcvbn, whose matching grows quadratically with the length
+const MAX_STRENGTH_PASSWORD_LENGTH = 100
+
+// guesses per second for the attack scenarios reported in crack time estimates
+var crackScenarios = []struct {
+	name             string
+	guessesPerSecond float64
+}{
+	{"onlineThrottled", 100.0 / 3600},
+	{"onlineUnthrottled", 10},
+	{"offlineSlowHash", 1e4},
+	{"offlineFastHash", 1e10},
+}
+
+// PasswordStrengthResult is the strength estimate of a password
+type PasswordStrengthResult struct {
+	Score       int                     `json:"score"`
+	Entropy     float64                 `json:"entropy"`
+	CrackTimes  map[string]CrackTime    `json:"crackTimes"`
+	Matches     []PasswordStrengthMatch `json:"matches"`
+	Warning     string                  `json:"warning"`
+	Suggestions []string                `json:"suggestions"`
+}
+
+// CrackTime is the average time to guess a password in one attack scenario
+type CrackTime struct {
+	Seconds float64 `json:"seconds"`
+	Display string  `json:"display"`
+}
+
+// PasswordStrengthMatch is a guessable part of a password
+type PasswordStrengthMatch struct {
+	Pattern    string  `json:"pattern"`
+	Token      string  `json:"token"`
+	Dictionary string  `json:"dictionary,omitempty"`
+	L33t       bool    `json:"l33t,omitempty"`
+	Entropy    float64 `json:"entropy"`
+}
+
+// PasswordStrength - POST /password/strength
+// Params:
+// - password : non-empty string to estimate, at most MAX_STRENGTH_PASSWORD_LENGTH characters
+// - userInputs : string the password should not be based on, e.g. the username (optional, may be repeated)
+// Returns:
+// - strength estimate in JSON format:
+//   "score": integer from 0 (too guessable) to 4 (very unguessable),
+//   "entropy": number, bits,
+//   "crackTimes": { "onlineThrottled", "onlineUnthrottled", "offlineSlowHash", "offlineFastHash": { "seconds": number, "display": string } },
+//   "matches": [ { "pattern": dictionary, spatial, repeat, sequence, date or bruteforce, "token": string, "dictionary": string, "l33t": boolean, "entropy": number }, ... ],
+//   "warning": string,
+//   "suggestions": [ string, ... ]
+func PasswordStrength(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	passwordValues, ok := r.PostForm["password"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field password"))
+		return
+	}
+	password := passwordValues[0]
+	if len(password) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid password"))
+		return
+	}
+	if utf8.RuneCountInString(password) > MAX_STRENGTH_PASSWORD_LENGTH {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: password"))
+		return
+	}
+
+	result := EstimatePasswordStrength(password, r.PostForm["userInputs"])
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize password strength to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// EstimatePasswordStrength estimates how hard the password is to guess, callers have to enforce MAX_STRENGTH_PASSWORD_LENGTH
+func EstimatePasswordStrength(password string, userInputs []string) PasswordStrengthResult {
+	estimate := zxcvbn.PasswordStrength(password, userInputs)
+
+	result := PasswordStrengthResult{
+		Score:      estimate.Score,
+		Entropy:    roundTo(estimate.Entropy, 2),
+		CrackTimes: make(map[string]CrackTime, len(crackScenarios)),
+		Matches:    make([]PasswordStrengthMatch, 0, len(estimate.MatchSequence)),
+	}
+	// on average, half of the key space has to be searched
+	guesses := math.Pow(2, estimate.Entropy) / 2
+	for _, scenario := range crackScenarios {
+		seconds := guesses / scenario.guessesPerSecond
+		result.CrackTimes[scenario.name] = CrackTime{Seconds: seconds, Display: displayDuration(seconds)}
+	}
+	for _, m := range estimate.MatchSequence {
+		result.Matches = append(result.Matches, PasswordStrengthMatch{
+			Pattern:    m.Pattern,
+			Token:      matchToken(password, m),
+			Dictionary: m.DictionaryName,
+			L33t:       isL33tMatch(password, m),
+			Entropy:    roundTo(m.Entropy, 2),
+		})
+	}
+	result.Warning, result.Suggestions = passwordFeedback(password, result.Score, estimate.MatchSequence)
+	return result
+}
+
+// matchToken returns the password characters of a match; zxcvbn reports rune offsets for dictionary matches,
+// which run on the runes of the (l33t-decoded) password, and byte offsets for all other patterns
+func matchToken(password string, m match.Match) string {
+	if m.Pattern == "dictionary" {
+		runes := []rune(password)
+		if m.I < 0 || m.I > m.J || m.J >= len(runes) {
+			return ""
+		}
+		return string(runes[m.I : m.J+1])
+	}
+	if m.I < 0 || m.I > m.J || m.J >= len(password) {
+		return ""
+	}
+	return password[m.I : m.J+1]
+}
+
+// isL33tMatch reports whether a dictionary match was found only after undoing substitutions like '@' for 'a';
+// the match token then holds the dictionary word rather than the password characters
+func isL33tMatch(password string, m match.Match) bool {
+	return m.Pattern == "dictionary" && !strings.EqualFold(matchToken(password, m), m.Token)
+}
+
+// passwordFeedback derives a warning and suggestions from the weakest patterns, similar to zxcvbn's feedback
+func passwordFeedback(password string, score int, matches []match.Match) (string, []string) {
+	suggestions := make([]string, 0, 4)
+	if score > 2 {
+		return "", suggestions
+	}
+	if len(matches) == 0 || (len(matches) == 1 && matches[0].Pattern == "bruteforce") {
+		return "", append(suggestions, "Use a few words, avoid common phrases", "No need for symbols, digits, or uppercase letters")
+	}
+
+	warning := ""
+	seen := make(map[string]bool)
+	suggest := func(suggestion string) {
+		if !seen[suggestion] {
+			seen[suggestion] = true
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	suggest("Add another word or two. Uncommon words are better.")
+
+	// the longest match is the most relevant one for the warning
+	longest := matches[0]
+	for _, m := range matches {
+		if m.J-m.I > longest.J-longest.I {
+			longest = m
+		}
+	}
+
+	for _, m := range matches {
+		var matchWarning string
+		switch m.Pattern {
+		case "dictionary":
+			switch m.DictionaryName {
+			case "Passwords":
+				matchWarning = "This is similar to a commonly used password"
+			case "English":
+				matchWarning = "A word by itself is easy to guess"
+			case "MaleNames", "FemaleNames", "Surname":
+				matchWarning = "Names and surnames by themselves are easy to guess"
+			case "user_inputs":
+				matchWarning = "Passwords based on your personal information are easy to guess"
+			}
+			if isL33tMatch(password, m) {
+				suggest("Predictable substitutions like '@' instead of 'a' don't help very much")
+			}
+			token := matchToken(password, m)
+			if token != strings.ToLower(token) && token != strings.ToUpper(token) {
+				suggest("Capitalization doesn't help very much")
+			} else if len(token) > 1 && token == strings.ToUpper(token) && token != strings.ToLower(token) {
+				suggest("All-uppercase is almost as easy to guess as all-lowercase")
+			}
+		case "spatial":
+			matchWarning = "Keyboard patterns like \"qwerty\" are easy to guess"
+			suggest("Use a longer keyboard pattern with more turns")
+		case "repeat":
+			matchWarning = "Repeats like \"aaa\" or \"abcabc\" are easy to guess"
+			suggest("Avoid repeated words and characters")
+		case "sequence":
+			matchWarning = "Sequences like abc or 6543 are easy to guess"
+			suggest("Avoid sequences")
+		case "date":
+			matchWarning = "Dates are often easy to guess"
+			suggest("Avoid dates and years that are associated with you")
+		}
+		if m.I == longest.I && m.J == longest.J && matchWarning != "" {
+			warning = matchWarning
+		}
+	}
+	return warning, suggestions
+}
+
+// displayDuration formats seconds as a rounded, human readable duration
+func displayDuration(seconds float64) string {
+	units := []struct {
+		singular string
+		plural   string
+		seconds  float64
+	}{
+		{"century", "centuries", 100 * 365.25 * 24 * 3600},
+		{"year", "years", 365.25 * 24 * 3600},
+		{"month", "months", 30.44 * 24 * 3600},
+		{"day", "days", 24 * 3600},
+		{"hour", "hours", 3600},
+		{"minute", "minutes", 60},
+		{"second", "seconds", 1},
+	}
+	if seconds >= 100*units[0].seconds {
+		return "centuries"
+	}
+	for _, unit := range units {
+		if seconds >= unit.seconds {
+			count := int(math.Round(seconds / unit.seconds))
+			if count == 1 {
+				return "1 " + unit.singular
+			}
+			return strconv.Itoa(count) + " " + unit.plural
+		}
+	}
+	return "less than a second"
+}
+
+func roundTo(value float64, digits int) float64 {
+	factor := math.Pow(10, float64(digits))
+	return math.Round(value*factor) / factor
+}
@@ -0,0 +1,242 @@
+package keygen
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash/crc32"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_TOKEN_BYTES = 32
+
+const MIN_TOKEN_BYTES = 8
+
+const MAX_TOKEN_BYTES = 1024
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var tokenTypes = []string{"bytes", "uuid4", "uuid7", "ulid"}
+
+var tokenEncodings = map[string]interface{ EncodeToString([]byte) string }{
+	"hex":       hexEncoding{},
+	"base32":    base32.StdEncoding.WithPadding(base32.NoPadding),
+	"base64url": base64.RawURLEncoding,
+	"crockford": base32.NewEncoding(crockfordAlphabet).WithPadding(base32.NoPadding),
+}
+
+var tokenPrefixPattern = regexp.MustCompile("^[A-Za-z0-9]{1,16}$")
+
+// hexEncoding adapts encoding/hex to the EncodeToString interface of the other encodings
+type hexEncoding struct{}
+
+func (hexEncoding) EncodeToString(src []byte) string {
+	return hex.EncodeToString(src)
+}
+
+// Token - GET /token
+// Params:
+// - type : bytes, uuid4, uuid7 (RFC 9562, time-ordered) or ulid (time-ordered, Crockford base32) (optional, defaults to bytes)
+// - length : number of random bytes for type bytes, 8 to 1024 (optional, defaults to 32)
+// - encoding : hex, base32 (RFC 4648, unpadded), base64url (unpadded) or crockford (Crockford base32, unpadded),
+//   for type bytes (optional, defaults to hex)
+// - prefix : 1 to 16 ASCII letters or digits, prepended with an underscore, e.g. cad for cad_... (optional)
+// - checksum : true to append the CRC-32 of the prefixed token, in the token encoding, for type bytes;
+//   it detects typing errors and lets secret scanners recognize tokens without a database lookup (optional)
+// Returns:
+// - token (plain text)
+func Token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	incorrect := make([]string, 0, 5)
+	tokenType := tokenTypes[0]
+	if typeValues, ok := r.Form["type"]; ok {
+		tokenType = typeValues[0]
+		if !containsString(tokenTypes, tokenType) {
+			incorrect = append(incorrect, "type")
+		}
+	}
+	length := DEFAULT_TOKEN_BYTES
+	if lengthValues, ok := r.Form["length"]; ok {
+		var err error
+		length, err = strconv.Atoi(lengthValues[0])
+		if err != nil || length < MIN_TOKEN_BYTES || length > MAX_TOKEN_BYTES || tokenType != "bytes" {
+			incorrect = append(incorrect, "length")
+		}
+	}
+	encoding := "hex"
+	if encodingValues, ok := r.Form["encoding"]; ok {
+		encoding = encodingValues[0]
+		if _, ok := tokenEncodings[encoding]; !ok || tokenType != "bytes" {
+			incorrect = append(incorrect, "encoding")
+		}
+	}
+	prefix := ""
+	if prefixValues, ok := r.Form["prefix"]; ok {
+		prefix = prefixValues[0]
+		if !tokenPrefixPattern.MatchString(prefix) {
+			incorrect = append(incorrect, "prefix")
+		}
+	}
+	checksum := false
+	if checksumValues, ok := r.Form["checksum"]; ok {
+		var err error
+		checksum, err = strconv.ParseBool(checksumValues[0])
+		if err != nil || (checksum && tokenType != "bytes") {
+			incorrect = append(incorrect, "checksum")
+		}
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	var token string
+	var err error
+	switch tokenType {
+	case "uuid4":
+		token, err = newUUIDv4()
+	case "uuid7":
+		token, err = newUUIDv7(time.Now())
+	case "ulid":
+		token, err = newULID(time.Now())
+	default:
+		var random []byte
+		if random, err = GenerateKey(uint(length)); err == nil {
+			token = tokenEncodings[encoding].EncodeToString(random)
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not generate %v token: %v", tokenType, err.Error())
+		return
+	}
+
+	if prefix != "" {
+		token = prefix + "_" + token
+	}
+	if checksum {
+		token += tokenChecksum(token, encoding)
+	}
+	w.Write([]byte(token))
+}
+
+// VerifyToken - POST /token/verify
+// Params:
+// - token : token generated by /token with checksum=true
+// - encoding : the encoding of the token (optional, defaults to hex)
+// Returns:
+// - verification result in JSON format:
+//   "valid": boolean, true if the checksum matches
+func VerifyToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	tokenValues, ok := r.PostForm["token"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field token"))
+		return
+	}
+	encoding := "hex"
+	if encodingValues, ok := r.PostForm["encoding"]; ok {
+		encoding = encodingValues[0]
+		if _, ok := tokenEncodings[encoding]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("incorrect fields: encoding"))
+			return
+		}
+	}
+
+	result := struct {
+		Valid bool `json:"valid"`
+	}{}
+	token := tokenValues[0]
+	if checksumLength := len(tokenChecksum("", encoding)); len(token) > checksumLength {
+		body := token[:len(token)-checksumLength]
+		result.Valid = tokenChecksum(body, encoding) == token[len(body):]
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize verification result to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// tokenChecksum encodes the CRC-32 (IEEE) of the token
+func tokenChecksum(token, encoding string) string {
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE([]byte(token)))
+	return tokenEncodings[encoding].EncodeToString(checksum)
+}
+
+// newUUIDv4 generates a random UUID, RFC 9562 section 5.4
+func newUUIDv4() (string, error) {
+	uuid, err := GenerateKey(16)
+	if err != nil {
+		return "", err
+	}
+	return formatUUID(uuid, 4), nil
+}
+
+// newUUIDv7 generates a UUID starting with the Unix time in milliseconds, RFC 9562 section 5.7
+func newUUIDv7(now time.Time) (string, error) {
+	uuid, err := GenerateKey(16)
+	if err != nil {
+		return "", err
+	}
+	milliseconds := uint64(now.UnixMilli())
+	for i := 0; i < 6; i++ {
+		uuid[i] = byte(milliseconds >> (40 - 8*i))
+	}
+	return formatUUID(uuid, 7), nil
+}
+
+// formatUUID sets the version and variant bits and returns the UUID in its canonical form
+func formatUUID(uuid []byte, version byte) string {
+	uuid[6] = uuid[6]&0x0f | version<<4
+	uuid[8] = uuid[8]&0x3f | 0x80
+	encoded := hex.EncodeToString(uuid)
+	return encoded[:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:]
+}
+
+// newULID generates a ULID, 48 bits of Unix time in milliseconds followed by 80 random bits:
+// https://github.com/ulid/spec
+func newULID(now time.Time) (string, error) {
+	random, err := GenerateKey(10)
+	if err != nil {
+		return "", err
+	}
+	value := new(big.Int).SetUint64(uint64(now.UnixMilli()))
+	value.Lsh(value, 80)
+	value.Or(value, new(big.Int).SetBytes(random))
+
+	// 26 characters of 5 bits each, the first one holds the 3 most significant bits
+	ulid := make([]byte, 26)
+	mask := big.NewInt(31)
+	for i := len(ulid) - 1; i >= 0; i-- {
+		ulid[i] = crockfordAlphabet[new(big.Int).And(value, mask).Int64()]
+		value.Rsh(value, 5)
+	}
+	return string(ulid), nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
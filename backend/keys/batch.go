@@ -0,0 +1,239 @@
+package keys
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"../auth"
+	"../dbhelper"
+	"../keygen"
+)
+
+const MAX_BATCH_COUNT = 500
+
+// MAX_RSA_BATCH_COUNT is lower as RSA key generation takes up to seconds per key
+const MAX_RSA_BATCH_COUNT = 20
+
+// batchKeyTypes maps the batch types to their key store types
+var batchKeyTypes = map[string]string{
+	"password": "Password",
+	"aes":      "AES",
+	"twofish":  "Twofish",
+	"blowfish": "Blowfish",
+	"rsa":      "RSA",
+}
+
+// batchItem is a generated key, with its key store id and name if it was persisted
+type batchItem struct {
+	ID    int    `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value"`
+}
+
+// GenerateBatch - POST /keys/batch, optionally authenticated
+// Params:
+// - type : password, aes, twofish, blowfish or rsa
+// - count : number of items to generate, 1 to 500 (at most 20 for rsa)
+// - keyLength : key length in bits for aes, twofish, blowfish and rsa, as for /aes/key, /twofish/key, /blowfish/key
+//   and /rsa/key
+// - alphaLower, alphaUpper, numeric, special : character counts for password, as for /password;
+//   the password length can not exceed 256
+// - output : json or csv (optional, defaults to json)
+// - persist : true to store every item in the key store of the authenticated user (optional)
+// - name : naming pattern for persisted items, {n} is replaced by the 1-based item number,
+//   e.g. staging-db-{n} (required if persist is true)
+// Returns:
+// - json: items in a JSON array; symmetric keys are hex-encoded, RSA keys are PKCS #1 PEM blocks:
+//   [ { "id": integer, "name": string, for persisted items, "value": string }, ... ]
+// - csv: items as text/csv with an id,name,value header, id and name are empty unless persisted
+func GenerateBatch(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	missing := make([]string, 0, 2)
+	typeValues, ok := r.PostForm["type"]
+	if !ok {
+		missing = append(missing, "type")
+	}
+	countValues, ok := r.PostForm["count"]
+	if !ok {
+		missing = append(missing, "count")
+	}
+	if len(missing) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing fields: " + strings.Join(missing, ", ")))
+		return
+	}
+
+	incorrect := make([]string, 0, 4)
+	batchType := typeValues[0]
+	keyType, ok := batchKeyTypes[batchType]
+	if !ok {
+		incorrect = append(incorrect, "type")
+	}
+	maxCount := MAX_BATCH_COUNT
+	if batchType == "rsa" {
+		maxCount = MAX_RSA_BATCH_COUNT
+	}
+	count, err := strconv.Atoi(countValues[0])
+	if err != nil || count <= 0 || count > maxCount {
+		incorrect = append(incorrect, "count")
+	}
+	output := "json"
+	if outputValues, ok := r.PostForm["output"]; ok {
+		output = outputValues[0]
+		if output != "json" && output != "csv" {
+			incorrect = append(incorrect, "output")
+		}
+	}
+	persist := false
+	if persistValues, ok := r.PostForm["persist"]; ok {
+		if persist, err = strconv.ParseBool(persistValues[0]); err != nil {
+			incorrect = append(incorrect, "persist")
+		}
+	}
+	namePattern := r.PostForm.Get("name")
+	if persist && (!strings.Contains(namePattern, "{n}") || len(strings.Replace(namePattern, "{n}", strconv.Itoa(count), -1)) > 100) {
+		incorrect = append(incorrect, "name")
+	}
+	var generate func() (string, error)
+	if ok {
+		var incorrectOptions []string
+		generate, incorrectOptions = parseBatchGenerator(r, batchType)
+		incorrect = append(incorrect, incorrectOptions...)
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	userID := 0
+	if persist {
+		if userID, ok = auth.UserID(r); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	items := make([]batchItem, count)
+	for i := range items {
+		if items[i].Value, err = generate(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("can not generate %v: %v", batchType, err.Error())
+			return
+		}
+	}
+
+	if persist {
+		names := make([]string, count)
+		values := make([]string, count)
+		keyTypes := make([]string, count)
+		for i := range items {
+			names[i] = strings.Replace(namePattern, "{n}", strconv.Itoa(i+1), -1)
+			values[i] = items[i].Value
+			keyTypes[i] = keyType
+		}
+		ids, err := dbhelper.CreateKeys(names, values, keyTypes, userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("can not create keys: %v", err)
+			return
+		}
+		for i := range items {
+			items[i].ID, items[i].Name = ids[i], names[i]
+		}
+	}
+
+	if output == "csv" {
+		writeBatchCSV(w, items)
+		return
+	}
+	json, err := json.Marshal(items)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize keys to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// parseBatchGenerator reads the keyLength or character count params and returns the generator of a single item
+func parseBatchGenerator(r *http.Request, batchType string) (func() (string, error), []string) {
+	if batchType == "password" {
+		return parseBatchPasswordGenerator(r)
+	}
+
+	keyLength, err := strconv.Atoi(r.PostForm.Get("keyLength"))
+	supported := false
+	switch batchType {
+	case "aes", "twofish":
+		supported = keyLength == 128 || keyLength == 192 || keyLength == 256
+	case "blowfish":
+		supported = keyLength >= 32 && keyLength < 448 && keyLength%8 == 0
+	case "rsa":
+		supported = keyLength == 1024 || keyLength == 2048 || keyLength == 3072 || keyLength == 4096
+	}
+	if err != nil || !supported {
+		return nil, []string{"keyLength"}
+	}
+
+	if batchType == "rsa" {
+		return func() (string, error) {
+			privateKey, err := keygen.TakeRSAKey(keyLength)
+			if err != nil {
+				return "", err
+			}
+			encoded, err := keygen.EncodeKeyPair(privateKey, "pkcs1")
+			return string(encoded), err
+		}, nil
+	}
+	return func() (string, error) {
+		key, err := keygen.GenerateKey(uint(keyLength / 8))
+		return hex.EncodeToString(key), err
+	}, nil
+}
+
+// parseBatchPasswordGenerator reads the character count params of /password
+func parseBatchPasswordGenerator(r *http.Request) (func() (string, error), []string) {
+	incorrect := make([]string, 0, 4)
+	counts := make([]uint, 0, 4)
+	length := 0
+	for _, name := range []string{"alphaLower", "alphaUpper", "numeric", "special"} {
+		count, err := strconv.Atoi(r.PostForm.Get(name))
+		if err != nil || count < 0 {
+			incorrect = append(incorrect, name)
+		}
+		counts = append(counts, uint(count))
+		length += count
+	}
+	if len(incorrect) == 0 && (length == 0 || length > keygen.MAX_POLICY_PASSWORD_LENGTH) {
+		incorrect = append(incorrect, "alphaLower", "alphaUpper", "numeric", "special")
+	}
+	return func() (string, error) {
+		return keygen.GeneratePassword(counts[0], counts[1], counts[2], counts[3])
+	}, incorrect
+}
+
+// writeBatchCSV writes the items as CSV with a header row
+func writeBatchCSV(w http.ResponseWriter, items []batchItem) {
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "name", "value"})
+	for _, item := range items {
+		id := ""
+		if item.ID != 0 {
+			id = strconv.Itoa(item.ID)
+		}
+		writer.Write([]string{id, item.Name, item.Value})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("can not write keys as csv: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package keys
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGenerateBatchAES(t *testing.T) {
+	rr := postBatch(t, url.Values{"type": {"aes"}, "count": {"100"}, "keyLength": {"256"}})
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("GenerateBatch returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+
+	var items []batchItem
+	if err := json.Unmarshal(rr.Body.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 100 {
+		t.Fatalf("GenerateBatch returned incorrect item count: got: %v, expected: 100", len(items))
+	}
+	seen := make(map[string]bool)
+	for _, item := range items {
+		key, err := hex.DecodeString(item.Value)
+		if err != nil || len(key) != 32 || seen[item.Value] {
+			t.Errorf("GenerateBatch returned incorrect or duplicate key: %v", item.Value)
+		}
+		seen[item.Value] = true
+	}
+}
+
+func TestGenerateBatchPasswordCSV(t *testing.T) {
+	payload := url.Values{"type": {"password"}, "count": {"5"}, "alphaLower": {"4"}, "alphaUpper": {"4"}, "numeric": {"4"}, "special": {"0"}, "output": {"csv"}}
+	rr := postBatch(t, payload)
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("GenerateBatch returned incorrect content type: %v", contentType)
+	}
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || strings.Join(records[0], ",") != "id,name,value" {
+		t.Fatalf("GenerateBatch returned incorrect csv: %v", records)
+	}
+	for _, record := range records[1:] {
+		if record[0] != "" || record[1] != "" || len(record[2]) != 12 {
+			t.Errorf("GenerateBatch returned incorrect record: %v", record)
+		}
+	}
+}
+
+func TestGenerateBatchIncorrectFields(t *testing.T) {
+	payload := url.Values{"type": {"rsa"}, "count": {"21"}, "keyLength": {"512"}, "persist": {"true"}, "name": {"runner"}}
+	rr := postBatch(t, payload)
+	expected := "incorrect fields: count, name, keyLength"
+	if rr.Code != http.StatusBadRequest || rr.Body.String() != expected {
+		t.Errorf("GenerateBatch returned unexpected response: got: %v %v, expected: %v", rr.Code, rr.Body.String(), expected)
+	}
+}
+
+func TestGenerateBatchPersistUnauthenticated(t *testing.T) {
+	payload := url.Values{"type": {"twofish"}, "count": {"2"}, "keyLength": {"128"}, "persist": {"true"}, "name": {"runner-{n}"}}
+	rr := postBatch(t, payload)
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("GenerateBatch returned incorrect status code: got: %v, expected: %v", status, http.StatusUnauthorized)
+	}
+}
+
+func postBatch(t *testing.T, payload url.Values) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/keys/batch", strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(GenerateBatch)
+	handler.ServeHTTP(rr, req)
+	return rr
+}
@@ -7,8 +7,8 @@ import (
 	"strconv"
 	"strings"
 
+	"../auth"
 	"../dbhelper"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 )
 
@@ -24,14 +24,18 @@ const DEFAULT_ITEMS_PER_PAGE = 10
 //	   {
 //	     "id": non-negative integer,
 //	     "name": string,
-//	     "type": string: RSA, AES, Blowfish, Twofish or Password,
+//	     "type": string: RSA, ECDSA, AES, Blowfish, Twofish, Password, X.509, TOTP or SSH,
 //	     "value": string
 //     },
 //     ...
 //   ],
 //   "total": non-negative integer
 func ListKeys(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
+	userID, ok := auth.UserID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 	r.ParseForm()
 	page := 1
 	itemsPerPage := DEFAULT_ITEMS_PER_PAGE
@@ -78,12 +82,16 @@ func ListKeys(w http.ResponseWriter, r *http.Request) {
 // PersistKey - POST /keys, PUT /keys, authenticated
 // Params:
 // - name: string
-// - type: string: RSA, AES, Blowfish, Twofish or Password,
+// - type: string: RSA, ECDSA, AES, Blowfish, Twofish, Password, X.509, TOTP or SSH,
 // - value: string
 // Returns:
 // Status code 200 on success
 func PersistKey(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
+	userID, ok := auth.UserID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 	r.ParseForm()
 
 	missing := make([]string, 0, 3)
@@ -108,7 +116,7 @@ func PersistKey(w http.ResponseWriter, r *http.Request) {
 	incorrect := make([]string, 0, 2)
 	name := nameValues[0]
 	keyType := typeValues[0]
-	if keyType != "RSA" && keyType != "AES" && keyType != "Blowfish" && keyType != "Twofish" && keyType != "Password" {
+	if keyType != "RSA" && keyType != "ECDSA" && keyType != "AES" && keyType != "Blowfish" && keyType != "Twofish" && keyType != "Password" && keyType != "X.509" && keyType != "TOTP" && keyType != "SSH" {
 		incorrect = append(incorrect, "type")
 	}
 	value := valueValues[0]
@@ -121,7 +129,7 @@ func PersistKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := dbhelper.CreateKey(name, keyType, value, userID); err != nil {
+	if _, err := dbhelper.CreateKey(name, keyType, value, userID); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("can not create key: %v", err)
 	}
@@ -133,7 +141,11 @@ func PersistKey(w http.ResponseWriter, r *http.Request) {
 // Returns:
 // Status code 200 on success
 func RenameKey(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
+	userID, ok := auth.UserID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 	vars := mux.Vars(r)
 	keyID, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -169,7 +181,11 @@ func RenameKey(w http.ResponseWriter, r *http.Request) {
 // Returns:
 // Status code 200 on success
 func DeleteKey(w http.ResponseWriter, r *http.Request) {
-	userID := getUserID(r)
+	userID, ok := auth.UserID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 	vars := mux.Vars(r)
 	keyID, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -196,9 +212,3 @@ func DeleteKey(w http.ResponseWriter, r *http.Request) {
 		log.Printf("can not delete key: %v", err)
 	}
 }
-
-func getUserID(r *http.Request) int {
-	token := r.Context().Value("user").(*jwt.Token)
-	claims := token.Claims.(jwt.MapClaims)
-	return int(claims["user_id"].(float64))
-}
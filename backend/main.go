@@ -12,6 +12,9 @@ import (
 	"./hashing"
 	"./keygen"
 	"./keys"
+	"./otp"
+	"./pki"
+	"./secrets"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/rs/cors"
@@ -20,7 +23,7 @@ import (
 
 func main() {
 	// parse config
-	dbConnectionString, jwtSecret, err := confhelper.ParseConfig("./config.json")
+	dbConnectionString, jwtSecret, rsaKeyPool, err := confhelper.ParseConfig("./config.json")
 	if err != nil {
 		log.Fatalf("can not parse \"./config.json\": %v", err.Error())
 	}
@@ -30,6 +33,12 @@ func main() {
 		log.Fatalf("can not connect to database: %v", err.Error())
 	}
 	auth.SetJWTSecret(jwtSecret)
+	secrets.StartCleanup(time.Minute)
+	for keyLength, capacity := range rsaKeyPool {
+		if err := keygen.StartRSAKeyPool(keyLength, capacity); err != nil {
+			log.Fatalf("can not start %v-bit RSA key pool: %v", keyLength, err.Error())
+		}
+	}
 
 	// register routes
 	r := mux.NewRouter()
@@ -37,25 +46,90 @@ func main() {
 	// encrypt
 	r.HandleFunc("/rsa/encrypt", encrypt.RSAEncrypt).Methods("POST")
 	r.HandleFunc("/rsa/decrypt", encrypt.RSADecrypt).Methods("POST")
+	r.HandleFunc("/ecdsa/sign", encrypt.ECDSASign).Methods("POST")
+	r.HandleFunc("/ecdsa/verify", encrypt.ECDSAVerify).Methods("POST")
 	r.HandleFunc("/aes/encrypt", encrypt.AESEncrypt).Methods("POST")
 	r.HandleFunc("/aes/decrypt", encrypt.AESDecrypt).Methods("POST")
+	r.HandleFunc("/aes-siv/encrypt", encrypt.AESSIVEncrypt).Methods("POST")
+	r.HandleFunc("/aes-siv/decrypt", encrypt.AESSIVDecrypt).Methods("POST")
+	r.HandleFunc("/ff1/encrypt", encrypt.FF1Encrypt).Methods("POST")
+	r.HandleFunc("/ff1/decrypt", encrypt.FF1Decrypt).Methods("POST")
+	r.HandleFunc("/ff3-1/encrypt", encrypt.FF31Encrypt).Methods("POST")
+	r.HandleFunc("/ff3-1/decrypt", encrypt.FF31Decrypt).Methods("POST")
+	r.Handle("/aes-kw/wrap", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(encrypt.AESKeyWrap))).Methods("POST")
+	r.Handle("/aes-kw/unwrap", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(encrypt.AESKeyUnwrap))).Methods("POST")
+	r.Handle("/aes-kwp/wrap", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(encrypt.AESKeyWrapPad))).Methods("POST")
+	r.Handle("/aes-kwp/unwrap", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(encrypt.AESKeyUnwrapPad))).Methods("POST")
 	r.HandleFunc("/blowfish/encrypt", encrypt.BlowfishEncrypt).Methods("POST")
 	r.HandleFunc("/blowfish/decrypt", encrypt.BlowfishDecrypt).Methods("POST")
 	r.HandleFunc("/twofish/encrypt", encrypt.TwofishEncrypt).Methods("POST")
 	r.HandleFunc("/twofish/decrypt", encrypt.TwofishDecrypt).Methods("POST")
+	r.HandleFunc("/3des/encrypt", encrypt.TripleDESEncrypt).Methods("POST")
+	r.HandleFunc("/3des/decrypt", encrypt.TripleDESDecrypt).Methods("POST")
+	r.HandleFunc("/cast5/encrypt", encrypt.CAST5Encrypt).Methods("POST")
+	r.HandleFunc("/cast5/decrypt", encrypt.CAST5Decrypt).Methods("POST")
+	r.HandleFunc("/camellia/encrypt", encrypt.CamelliaEncrypt).Methods("POST")
+	r.HandleFunc("/camellia/decrypt", encrypt.CamelliaDecrypt).Methods("POST")
+	r.HandleFunc("/sm4/encrypt", encrypt.SM4Encrypt).Methods("POST")
+	r.HandleFunc("/sm4/decrypt", encrypt.SM4Decrypt).Methods("POST")
+	r.HandleFunc("/xtea/encrypt", encrypt.XTEAEncrypt).Methods("POST")
+	r.HandleFunc("/xtea/decrypt", encrypt.XTEADecrypt).Methods("POST")
 
 	// key and password generation
-	r.HandleFunc("/rsa/key", keygen.RSAKey).Methods("GET")
+	r.HandleFunc("/rsa/key", keygen.RSAKey).Methods("GET", "POST")
+	r.HandleFunc("/rsa/key/pool", keygen.RSAKeyPoolStatus).Methods("GET")
+	r.HandleFunc("/ecdsa/key", keygen.ECDSAKey).Methods("GET", "POST")
+	r.HandleFunc("/x509/self-signed", keygen.SelfSignedCertificate).Methods("POST")
+	r.HandleFunc("/ssh/key", keygen.SSHKey).Methods("GET", "POST")
 	r.HandleFunc("/aes/key", keygen.AESKey).Methods("GET")
+	r.HandleFunc("/aes-siv/key", keygen.AESSIVKey).Methods("GET")
 	r.HandleFunc("/blowfish/key", keygen.BlowfishKey).Methods("GET")
 	r.HandleFunc("/twofish/key", keygen.TwofishKey).Methods("GET")
+	r.HandleFunc("/3des/key", keygen.TripleDESKey).Methods("GET")
+	r.HandleFunc("/cast5/key", keygen.CAST5Key).Methods("GET")
+	r.HandleFunc("/camellia/key", keygen.CamelliaKey).Methods("GET")
+	r.HandleFunc("/sm4/key", keygen.SM4Key).Methods("GET")
+	r.HandleFunc("/xtea/key", keygen.XTEAKey).Methods("GET")
 	r.HandleFunc("/password", keygen.Password).Methods("GET")
+	r.HandleFunc("/password/strength", keygen.PasswordStrength).Methods("POST")
+	r.HandleFunc("/password/template", keygen.TemplatePassword).Methods("GET")
+	r.HandleFunc("/password/policy", keygen.PolicyPassword).Methods("GET")
+	r.HandleFunc("/password/presets", keygen.PasswordPresets).Methods("GET")
+	r.HandleFunc("/passphrase", keygen.Passphrase).Methods("GET")
+	r.HandleFunc("/token", keygen.Token).Methods("GET")
+	r.HandleFunc("/token/verify", keygen.VerifyToken).Methods("POST")
+	r.HandleFunc("/bip39/mnemonic", keygen.Mnemonic).Methods("GET")
+	r.HandleFunc("/bip39/validate", keygen.ValidateMnemonic).Methods("POST")
+	r.HandleFunc("/bip39/key", keygen.MnemonicKey).Methods("POST")
+
+	// key inspection and conversion
+	r.HandleFunc("/key/inspect", encrypt.InspectKey).Methods("POST")
+	r.Handle("/key/convert", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(encrypt.ConvertKey))).Methods("POST")
+
+	// x509 certificates
+	r.Handle("/x509/csr", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(pki.CreateCSR))).Methods("POST")
+	r.HandleFunc("/x509/csr/parse", pki.ParseCSR).Methods("POST")
+	r.Handle("/pkcs12/export", auth.JwtMiddleware.Handler(http.HandlerFunc(pki.ExportPKCS12))).Methods("POST")
+	r.Handle("/pkcs12/import", auth.JwtMiddleware.Handler(http.HandlerFunc(pki.ImportPKCS12))).Methods("POST")
+
+	// one-time passwords
+	r.HandleFunc("/otp/secret", otp.Secret).Methods("GET")
+	r.Handle("/otp/code", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(otp.Code))).Methods("POST")
+	r.Handle("/otp/verify", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(otp.Verify))).Methods("POST")
+
+	// certificate authority
+	r.Handle("/ca", auth.JwtMiddleware.Handler(http.HandlerFunc(pki.CreateCA))).Methods("POST")
+	r.Handle("/ca/{id:[0-9]+}/certificates", auth.JwtMiddleware.Handler(http.HandlerFunc(pki.IssueCertificate))).Methods("POST")
+	r.Handle("/ca/{id:[0-9]+}/certificates", auth.JwtMiddleware.Handler(http.HandlerFunc(pki.ListCertificates))).Methods("GET")
+	r.Handle("/ca/{id:[0-9]+}/certificates/{serial:[0-9a-fA-F]+}/revoke", auth.JwtMiddleware.Handler(http.HandlerFunc(pki.RevokeCertificate))).Methods("POST")
+	r.HandleFunc("/ca/{id:[0-9]+}/crl", pki.CRL).Methods("GET")
 
 	// hashing
 	r.HandleFunc("/hashing/md5", hashing.MD5).Methods("POST")
 	r.HandleFunc("/hashing/sha-224", hashing.SHA224).Methods("POST")
 	r.HandleFunc("/hashing/sha-256", hashing.SHA256).Methods("POST")
 	r.HandleFunc("/hashing/sha-512", hashing.SHA512).Methods("POST")
+	r.HandleFunc("/kdf", hashing.KDF).Methods("POST")
 
 	// auth
 	r.HandleFunc("/auth/register", auth.Register).Methods("POST", "PUT")
@@ -68,10 +142,21 @@ func main() {
 	// persistance
 	r.Handle("/keys", auth.JwtMiddleware.Handler(http.HandlerFunc(keys.ListKeys))).Methods("GET")
 	r.Handle("/keys", auth.JwtMiddleware.Handler(http.HandlerFunc(keys.PersistKey))).Methods("POST", "PUT")
+	r.Handle("/keys/batch", auth.OptionalJwtMiddleware.Handler(http.HandlerFunc(keys.GenerateBatch))).Methods("POST")
 	r.Handle("/keys/{id:[0-9]+}", auth.JwtMiddleware.Handler(http.HandlerFunc(keys.RenameKey))).Methods("POST")
 	r.Handle("/keys/{id:[0-9]+}", auth.JwtMiddleware.Handler(http.HandlerFunc(keys.DeleteKey))).Methods("DELETE")
 
-	c := cors.AllowAll()
+	// one-time secrets
+	r.HandleFunc("/secrets", secrets.CreateSecret).Methods("POST", "PUT")
+	r.HandleFunc("/secrets/{id:[0-9a-f]{32}}", secrets.SecretStatus).Methods("GET")
+	r.HandleFunc("/secrets/{id:[0-9a-f]{32}}", secrets.RevealSecret).Methods("POST")
+
+	c := cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"HEAD", "GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"Deprecation", "Warning", "X-Password-Strength-Score", "X-Password-Entropy"},
+	})
 	
 	// server configuration
 	server := &http.Server{
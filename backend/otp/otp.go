@@ -0,0 +1,475 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"../auth"
+	"../dbhelper"
+)
+
+const DEFAULT_SECRET_LENGTH = 20
+
+const MIN_SECRET_LENGTH = 10
+
+const MAX_SECRET_LENGTH = 64
+
+const DEFAULT_PERIOD = 30
+
+const MAX_PERIOD = 300
+
+const DEFAULT_WINDOW = 1
+
+const MAX_WINDOW = 10
+
+var algorithms = map[string]func() hash.Hash{
+	"SHA1":   sha1.New,
+	"SHA256": sha256.New,
+	"SHA512": sha512.New,
+}
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var errOTPAuth = errors.New("otp: stored secrets require authentication")
+
+var errOTPKey = errors.New("otp: key not found or not a TOTP secret")
+
+// parameters describe a one-time password generator, as encoded in an otpauth:// URI
+type parameters struct {
+	kind      string
+	secret    []byte
+	issuer    string
+	account   string
+	algorithm string
+	digits    int
+	period    int
+	counter   uint64
+	// stored key the parameters were read from, nil for secrets passed in the request
+	key *dbhelper.Key
+	id  int
+}
+
+// Secret - GET /otp/secret
+// Params:
+// - type : totp (RFC 6238) or hotp (RFC 4226) (optional, defaults to totp)
+// - account : non-empty string, the account name shown by authenticator apps
+// - issuer : the provider or service name shown by authenticator apps (optional)
+// - secretLength : secret length in bytes, 10 to 64 (optional, defaults to 20)
+// - algorithm : SHA1, SHA256 or SHA512 (optional, defaults to SHA1, the only algorithm supported by most authenticator apps)
+// - digits : 6, 7 or 8 (optional, defaults to 6)
+// - period : time step in seconds for totp, 1 to 300 (optional, defaults to 30)
+// - counter : initial counter for hotp (optional, defaults to 0)
+// Returns:
+// - secret in JSON format; the URI is the value to persist as a TOTP key:
+//   "secret": string, base32-encoded without padding,
+//   "uri": string, otpauth:// URI, e.g. for a QR code
+func Secret(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	accountValues, ok := r.Form["account"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field account"))
+		return
+	}
+
+	params := parameters{kind: "totp", account: accountValues[0], issuer: r.Form.Get("issuer")}
+	incorrect := parseOptions(r.Form, &params)
+	if typeValues, ok := r.Form["type"]; ok {
+		params.kind = typeValues[0]
+		if params.kind != "totp" && params.kind != "hotp" {
+			incorrect = append(incorrect, "type")
+		}
+	}
+	if params.account == "" || strings.Contains(params.account, ":") {
+		incorrect = append(incorrect, "account")
+	}
+	if strings.Contains(params.issuer, ":") {
+		incorrect = append(incorrect, "issuer")
+	}
+	secretLength := DEFAULT_SECRET_LENGTH
+	if secretLengthValues, ok := r.Form["secretLength"]; ok {
+		var err error
+		secretLength, err = strconv.Atoi(secretLengthValues[0])
+		if err != nil || secretLength < MIN_SECRET_LENGTH || secretLength > MAX_SECRET_LENGTH {
+			incorrect = append(incorrect, "secretLength")
+		}
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	params.secret = make([]byte, secretLength)
+	if _, err := io.ReadFull(rand.Reader, params.secret); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not generate secret: %v", err.Error())
+		return
+	}
+
+	result := struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}{
+		Secret: base32Encoding.EncodeToString(params.secret),
+		URI:    params.uri(),
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize secret to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// Code - POST /otp/code, optionally authenticated
+// Params:
+// - keyID : id of a stored TOTP key, requires authentication
+// - secret : base32-encoded secret or otpauth:// URI to use instead of keyID
+// - type, algorithm, digits, period, counter : as for /otp/secret, used with a base32 secret (optional)
+// Returns:
+// - current code in JSON format:
+//   "code": string,
+//   "validFor": integer, seconds until the next totp code, omitted for hotp
+func Code(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	params, ok := parseParameters(w, r)
+	if !ok {
+		return
+	}
+
+	result := struct {
+		Code     string `json:"code"`
+		ValidFor int64  `json:"validFor,omitempty"`
+	}{}
+	if params.kind == "totp" {
+		now := time.Now().Unix()
+		result.Code = generateCode(params.secret, params.algorithm, uint64(now)/uint64(params.period), params.digits)
+		result.ValidFor = int64(params.period) - now%int64(params.period)
+	} else {
+		result.Code = generateCode(params.secret, params.algorithm, params.counter, params.digits)
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize code to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// Verify - POST /otp/verify, optionally authenticated
+// For a stored hotp key a valid code moves the stored counter past it, so each code is accepted only once
+// Params:
+// - keyID, secret, type, algorithm, digits, period, counter : as for /otp/code
+// - code : the code to verify
+// - window : number of time steps accepted before and after the current one for totp,
+//   or after counter for hotp, 0 to 10 (optional, defaults to 1)
+// Returns:
+// - verification result in JSON format:
+//   "valid": boolean,
+//   "offset": integer, the matching time step relative to the current one, or counter value relative to counter,
+//   omitted if the code is not valid
+func Verify(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	params, ok := parseParameters(w, r)
+	if !ok {
+		return
+	}
+	codeValues, ok := r.PostForm["code"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field code"))
+		return
+	}
+	window := DEFAULT_WINDOW
+	if windowValues, ok := r.PostForm["window"]; ok {
+		var err error
+		window, err = strconv.Atoi(windowValues[0])
+		if err != nil || window < 0 || window > MAX_WINDOW {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("incorrect fields: window"))
+			return
+		}
+	}
+
+	result := struct {
+		Valid  bool `json:"valid"`
+		Offset *int `json:"offset,omitempty"`
+	}{}
+	if offset, ok := verifyCode(params, strings.TrimSpace(codeValues[0]), window, time.Now()); ok {
+		if params.kind == "hotp" && params.key != nil {
+			// a stored hotp counter moves past the accepted code, so the code can not be replayed
+			next := params
+			next.counter += uint64(offset) + 1
+			replaced, err := dbhelper.ReplaceKeyValue(params.id, params.key.Value, next.uri())
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				log.Printf("can not update hotp counter: %v", err.Error())
+				return
+			}
+			// the key changed since it was read, e.g. a concurrent request accepted the same code
+			ok = replaced
+		}
+		if ok {
+			result.Valid = true
+			result.Offset = &offset
+		}
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize verification result to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// parseParameters reads the generator from either the keyID or the secret field, writing the error response on failure
+func parseParameters(w http.ResponseWriter, r *http.Request) (parameters, bool) {
+	if keyIDValues, ok := r.PostForm["keyID"]; ok {
+		params, err := findStoredParameters(r, keyIDValues[0])
+		if err == errOTPAuth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return params, false
+		} else if err == errOTPKey {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid keyID"))
+			return params, false
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("can not retrieve key: %v", err.Error())
+			return params, false
+		}
+		return params, true
+	}
+
+	secretValues, ok := r.PostForm["secret"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field secret"))
+		return parameters{}, false
+	}
+	if strings.HasPrefix(secretValues[0], "otpauth://") {
+		params, err := parseURI(secretValues[0])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid secret"))
+			return params, false
+		}
+		return params, true
+	}
+
+	params := parameters{kind: "totp"}
+	incorrect := parseOptions(r.PostForm, &params)
+	if typeValues, ok := r.PostForm["type"]; ok {
+		params.kind = typeValues[0]
+		if params.kind != "totp" && params.kind != "hotp" {
+			incorrect = append(incorrect, "type")
+		}
+	}
+	secret, err := decodeSecret(secretValues[0])
+	if err != nil {
+		incorrect = append(incorrect, "secret")
+	}
+	params.secret = secret
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return params, false
+	}
+	return params, true
+}
+
+func findStoredParameters(r *http.Request, keyID string) (parameters, error) {
+	userID, ok := auth.UserID(r)
+	if !ok {
+		return parameters{}, errOTPAuth
+	}
+
+	id, err := strconv.Atoi(keyID)
+	if err != nil {
+		return parameters{}, errOTPKey
+	}
+	key, err := dbhelper.FindOwnedKey(id, userID, "TOTP")
+	if err != nil {
+		return parameters{}, err
+	}
+	if key == nil {
+		return parameters{}, errOTPKey
+	}
+	params, err := parseURI(key.Value)
+	if err != nil {
+		return parameters{}, errOTPKey
+	}
+	params.key, params.id = key, id
+	return params, nil
+}
+
+// parseOptions reads the algorithm, digits, period and counter params, setting the defaults for missing ones
+func parseOptions(values url.Values, params *parameters) (incorrect []string) {
+	params.algorithm, params.digits, params.period = "SHA1", 6, DEFAULT_PERIOD
+	if algorithmValues, ok := values["algorithm"]; ok {
+		params.algorithm = strings.ToUpper(algorithmValues[0])
+		if _, ok := algorithms[params.algorithm]; !ok {
+			incorrect = append(incorrect, "algorithm")
+		}
+	}
+	if digitsValues, ok := values["digits"]; ok {
+		var err error
+		params.digits, err = strconv.Atoi(digitsValues[0])
+		if err != nil || params.digits < 6 || params.digits > 8 {
+			incorrect = append(incorrect, "digits")
+		}
+	}
+	if periodValues, ok := values["period"]; ok {
+		var err error
+		params.period, err = strconv.Atoi(periodValues[0])
+		if err != nil || params.period <= 0 || params.period > MAX_PERIOD {
+			incorrect = append(incorrect, "period")
+		}
+	}
+	if counterValues, ok := values["counter"]; ok {
+		var err error
+		if params.counter, err = strconv.ParseUint(counterValues[0], 10, 64); err != nil {
+			incorrect = append(incorrect, "counter")
+		}
+	}
+	return
+}
+
+// uri encodes the parameters in the Key Uri Format used by authenticator apps,
+// see https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func (params parameters) uri() string {
+	label := url.PathEscape(params.account)
+	query := url.Values{}
+	query.Set("secret", base32Encoding.EncodeToString(params.secret))
+	if params.issuer != "" {
+		label = url.PathEscape(params.issuer) + ":" + label
+		query.Set("issuer", params.issuer)
+	}
+	query.Set("algorithm", params.algorithm)
+	query.Set("digits", strconv.Itoa(params.digits))
+	if params.kind == "totp" {
+		query.Set("period", strconv.Itoa(params.period))
+	} else {
+		query.Set("counter", strconv.FormatUint(params.counter, 10))
+	}
+	return "otpauth://" + params.kind + "/" + label + "?" + query.Encode()
+}
+
+// parseURI decodes an otpauth:// URI
+func parseURI(uri string) (parameters, error) {
+	var params parameters
+	u, err := url.Parse(uri)
+	if err != nil {
+		return params, err
+	}
+	if u.Scheme != "otpauth" || (u.Host != "totp" && u.Host != "hotp") {
+		return params, errors.New("not an otpauth URI")
+	}
+	params.kind = u.Host
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(label, ":"); i >= 0 {
+		params.issuer, params.account = label[:i], strings.TrimSpace(label[i+1:])
+	} else {
+		params.account = label
+	}
+	query := u.Query()
+	if issuer := query.Get("issuer"); issuer != "" {
+		params.issuer = issuer
+	}
+	if incorrect := parseOptions(query, &params); len(incorrect) > 0 {
+		return params, errors.New("invalid otpauth URI parameters: " + strings.Join(incorrect, ", "))
+	}
+	if params.kind == "hotp" && query.Get("counter") == "" {
+		return params, errors.New("missing hotp counter")
+	}
+	if params.secret, err = decodeSecret(query.Get("secret")); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// decodeSecret decodes a base32 secret, ignoring case, spaces and padding
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	decoded, err := base32Encoding.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	return decoded, nil
+}
+
+// generateCode implements the HOTP algorithm from RFC 4226, section 5.3
+func generateCode(secret []byte, algorithm string, counter uint64, digits int) string {
+	mac := hmac.New(algorithms[algorithm], secret)
+	binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulus)
+}
+
+// verifyCode checks the code against the time steps around now for totp, or the counter values from counter on for hotp,
+// returning the offset of the matching step
+func verifyCode(params parameters, code string, window int, now time.Time) (int, bool) {
+	if len(code) != params.digits {
+		return 0, false
+	}
+	if params.kind == "hotp" {
+		for offset := 0; offset <= window; offset++ {
+			expected := generateCode(params.secret, params.algorithm, params.counter+uint64(offset), params.digits)
+			if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+				return offset, true
+			}
+		}
+		return 0, false
+	}
+
+	step := now.Unix() / int64(params.period)
+	for offset := -window; offset <= window; offset++ {
+		if step+int64(offset) < 0 {
+			continue
+		}
+		expected := generateCode(params.secret, params.algorithm, uint64(step+int64(offset)), params.digits)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return offset, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,145 @@
+package otp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateCodeRFC4226(t *testing.T) {
+	// RFC 4226, appendix D
+	secret := []byte("12345678901234567890")
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range expected {
+		if result := generateCode(secret, "SHA1", uint64(counter), 6); result != code {
+			t.Errorf("generateCode returned incorrect code for counter %v: got: %v, expected: %v", counter, result, code)
+		}
+	}
+}
+
+func TestVerifyCodeRFC6238(t *testing.T) {
+	// RFC 6238, appendix B
+	vectors := []struct {
+		algorithm string
+		secret    string
+		unixTime  int64
+		code      string
+	}{
+		{"SHA1", "12345678901234567890", 59, "94287082"},
+		{"SHA256", "12345678901234567890123456789012", 59, "46119246"},
+		{"SHA512", "1234567890123456789012345678901234567890123456789012345678901234", 59, "90693936"},
+		{"SHA1", "12345678901234567890", 1111111109, "07081804"},
+		{"SHA256", "12345678901234567890123456789012", 20000000000, "77737706"},
+	}
+	for _, v := range vectors {
+		params := parameters{kind: "totp", secret: []byte(v.secret), algorithm: v.algorithm, digits: 8, period: 30}
+		if offset, ok := verifyCode(params, v.code, 0, time.Unix(v.unixTime, 0)); !ok || offset != 0 {
+			t.Errorf("verifyCode rejected %v code %v at %v", v.algorithm, v.code, v.unixTime)
+		}
+		// the code is still accepted one time step later with the default window
+		if offset, ok := verifyCode(params, v.code, 1, time.Unix(v.unixTime+30, 0)); !ok || offset != -1 {
+			t.Errorf("verifyCode returned incorrect offset for %v code %v: got: %v, %v", v.algorithm, v.code, offset, ok)
+		}
+		if _, ok := verifyCode(params, v.code, 1, time.Unix(v.unixTime+90, 0)); ok {
+			t.Errorf("verifyCode accepted %v code %v outside of the window", v.algorithm, v.code)
+		}
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	params := parameters{kind: "totp", secret: []byte("12345678901234567890"), issuer: "Example Co", account: "alice@example.com", algorithm: "SHA256", digits: 8, period: 60}
+	uri := params.uri()
+	if !strings.HasPrefix(uri, "otpauth://totp/Example%20Co:alice@example.com?") || !strings.Contains(uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ") {
+		t.Errorf("uri returned incorrect URI: %v", uri)
+	}
+
+	parsed, err := parseURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.kind != params.kind || string(parsed.secret) != string(params.secret) || parsed.issuer != params.issuer || parsed.account != params.account ||
+		parsed.algorithm != params.algorithm || parsed.digits != params.digits || parsed.period != params.period {
+		t.Errorf("parseURI returned incorrect parameters: got: %+v, expected: %+v", parsed, params)
+	}
+
+	if _, err := parseURI("otpauth://hotp/alice?secret=GEZDGNBVGY3TQOJQ"); err == nil {
+		t.Errorf("parseURI accepted an hotp URI without counter")
+	}
+}
+
+func TestSecretAndVerify(t *testing.T) {
+	req, err := http.NewRequest("GET", "/otp/secret?account=alice&issuer=Example", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Secret).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Secret returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	var secret struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &secret); err != nil {
+		t.Fatal(err)
+	}
+	if len(secret.Secret) != 32 {
+		t.Errorf("Secret returned incorrect secret length: got: %v, expected: 32", len(secret.Secret))
+	}
+
+	rr = postForm(t, Code, "/otp/code", url.Values{"secret": {secret.URI}})
+	var code struct {
+		Code     string `json:"code"`
+		ValidFor int    `json:"validFor"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &code); err != nil {
+		t.Fatal(err)
+	}
+	if len(code.Code) != 6 || code.ValidFor <= 0 || code.ValidFor > 30 {
+		t.Errorf("Code returned incorrect code: %+v", code)
+	}
+
+	// the same secret given in base32 with the default options
+	rr = postForm(t, Verify, "/otp/verify", url.Values{"secret": {strings.ToLower(secret.Secret)}, "code": {code.Code}})
+	if body := rr.Body.String(); !strings.Contains(body, `"valid":true`) {
+		t.Errorf("Verify rejected the current code: %v", body)
+	}
+}
+
+func TestVerifyHOTP(t *testing.T) {
+	payload := url.Values{"secret": {"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}, "type": {"hotp"}, "counter": {"3"}, "code": {"254676"}, "window": {"2"}}
+	rr := postForm(t, Verify, "/otp/verify", payload)
+	if body := rr.Body.String(); body != `{"valid":true,"offset":2}` {
+		t.Errorf("Verify returned incorrect result: %v", body)
+	}
+
+	payload.Set("window", "1")
+	rr = postForm(t, Verify, "/otp/verify", payload)
+	if body := rr.Body.String(); body != `{"valid":false}` {
+		t.Errorf("Verify returned incorrect result: %v", body)
+	}
+}
+
+func TestCodeStoredKeyUnauthenticated(t *testing.T) {
+	rr := postForm(t, Code, "/otp/code", url.Values{"keyID": {"1"}})
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("Code returned incorrect status code: got: %v, expected: %v", status, http.StatusUnauthorized)
+	}
+}
+
+func postForm(t *testing.T, handlerFunc http.HandlerFunc, path string, payload url.Values) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", path, strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handlerFunc.ServeHTTP(rr, req)
+	return rr
+}
@@ -0,0 +1,559 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"../auth"
+	"../dbhelper"
+	"../keygen"
+	"github.com/gorilla/mux"
+)
+
+const CRL_VALIDITY_DAYS = 7
+
+// revocationReasons maps the RFC 5280 CRLReason names to their codes
+var revocationReasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"cACompromise":         2,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+	"certificateHold":      6,
+	"privilegeWithdrawn":   9,
+	"aACompromise":         10,
+}
+
+// certificateAuthority is a CA certificate with its private key, stored as an X.509 key
+type certificateAuthority struct {
+	certificate *x509.Certificate
+	key         crypto.Signer
+	// PEM input the key is read from by unlock
+	data []byte
+}
+
+// issuedCertificate is an issued certificate in JSON format
+type issuedCertificate struct {
+	SerialNumber     string     `json:"serialNumber"`
+	Subject          string     `json:"subject"`
+	IssuedOn         time.Time  `json:"issuedOn"`
+	ExpiresOn        time.Time  `json:"expiresOn"`
+	Status           string     `json:"status"`
+	RevokedOn        *time.Time `json:"revokedOn,omitempty"`
+	RevocationReason string     `json:"revocationReason,omitempty"`
+	Certificate      string     `json:"certificate"`
+}
+
+// CreateCA - POST /ca, authenticated
+// Params:
+// - name : name of the stored CA key
+// - keyType, keyLength, curve : the CA key, as for /x509/self-signed (optional, defaults to an ECDSA P-256 key)
+// - commonName : non-empty string
+// - organization, organizationalUnit, country, province, locality : subject fields (optional)
+// - validity : positive integer, validity in days (optional, defaults to 3650, at most 3650)
+// Returns:
+// - the stored CA in JSON format:
+//   "id": integer, id of the X.509 key holding the CA certificate and private key,
+//   "certificate": string, CA certificate in PEM format
+func CreateCA(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	userID, ok := auth.UserID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	missing := make([]string, 0, 2)
+	nameValues, ok := r.PostForm["name"]
+	if !ok {
+		missing = append(missing, "name")
+	}
+	if _, ok := r.PostForm["commonName"]; !ok {
+		missing = append(missing, "commonName")
+	}
+	if len(missing) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing fields: " + strings.Join(missing, ", ")))
+		return
+	}
+
+	newKey, incorrect := keygen.ParseKeyOptions(r)
+	name := nameValues[0]
+	if len(name) == 0 || len(name) > 100 {
+		incorrect = append(incorrect, "name")
+	}
+	subject, incorrectSubject := keygen.ParseSubject(r)
+	incorrect = append(incorrect, incorrectSubject...)
+	template := &x509.Certificate{Subject: subject, BasicConstraintsValid: true, IsCA: true, MaxPathLenZero: true}
+	incorrect = append(incorrect, keygen.ParseCertificateOptions(r, template, newKey.KeyType, keygen.MAX_CERTIFICATE_VALIDITY_DAYS)...)
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+	// issuing certificates and CRLs is what the CA key is for
+	template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	privateKey, err := newKey.Generate()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not generate key: %v", err.Error())
+		return
+	}
+	if template.SerialNumber, err = keygen.GenerateSerialNumber(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not generate serial number: %v", err.Error())
+		return
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not create certificate: %v", err.Error())
+		return
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not encode private key: %v", err.Error())
+		return
+	}
+
+	certificatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}))
+	value := certificatePEM + string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	id, err := dbhelper.CreateKey(name, "X.509", value, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not create key: %v", err)
+		return
+	}
+
+	result := struct {
+		ID          int    `json:"id"`
+		Certificate string `json:"certificate"`
+	}{
+		ID:          id,
+		Certificate: certificatePEM,
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize certificate authority to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// IssueCertificate - POST /ca/{id:[0-9]+}/certificates, authenticated
+// Path params:
+// - id : the id of a CA created with /ca belonging to the authenticated user
+// Params:
+// - csr : PKCS #10 certificate signing request in PEM format, its subject and subject alternative names are used (optional)
+// - keyType, keyLength, curve : the key to generate when no csr is given, as for /x509/self-signed
+// - commonName : non-empty string, required when no csr is given
+// - organization, organizationalUnit, country, province, locality : subject fields when no csr is given (optional)
+// - dnsNames, ipAddresses : subject alternative names when no csr is given, may be repeated (optional)
+// - validity : positive integer, validity in days (optional, defaults to 365, capped at the expiry of the CA)
+// - keyUsage, extKeyUsage : as for /x509/self-signed (optional)
+// - passphrase : passphrase of the CA private key if it is an encrypted PKCS #8 or OpenSSH key (optional)
+// Returns:
+// - certificate in PEM format ("CERTIFICATE"), followed by the generated private key in PKCS #8 PEM format
+//   ("PRIVATE KEY") when no csr is given
+func IssueCertificate(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	caKeyID, ca, ok := findCertificateAuthority(w, r)
+	if !ok {
+		return
+	}
+	if err := ca.unlock([]byte(r.PostForm.Get("passphrase"))); keygen.IsPassphraseError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid CA"))
+		return
+	}
+
+	var template *x509.Certificate
+	var publicKey crypto.PublicKey
+	var privateKey crypto.Signer
+	var incorrect []string
+	if csrValues, ok := r.PostForm["csr"]; ok {
+		csr, err := parseCertificateRequest([]byte(csrValues[0]))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid csr"))
+			return
+		}
+		template = &x509.Certificate{
+			Subject:               csr.Subject,
+			DNSNames:              csr.DNSNames,
+			IPAddresses:           csr.IPAddresses,
+			EmailAddresses:        csr.EmailAddresses,
+			URIs:                  csr.URIs,
+			BasicConstraintsValid: true,
+		}
+		publicKey = csr.PublicKey
+		keyType := "ecdsa"
+		if _, ok := publicKey.(*rsa.PublicKey); ok {
+			keyType = "rsa"
+		}
+		incorrect = keygen.ParseCertificateOptions(r, template, keyType, keygen.DEFAULT_CERTIFICATE_VALIDITY_DAYS)
+	} else {
+		if _, ok := r.PostForm["commonName"]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("missing field commonName"))
+			return
+		}
+		var newKey keygen.KeyOptions
+		newKey, incorrect = keygen.ParseKeyOptions(r)
+		template = &x509.Certificate{BasicConstraintsValid: true}
+		subject, incorrectSubject := keygen.ParseSubject(r)
+		template.Subject = subject
+		incorrect = append(incorrect, incorrectSubject...)
+		dnsNames, ipAddresses, incorrectNames := keygen.ParseSubjectAlternativeNames(r)
+		template.DNSNames, template.IPAddresses = dnsNames, ipAddresses
+		incorrect = append(incorrect, incorrectNames...)
+		incorrect = append(incorrect, keygen.ParseCertificateOptions(r, template, newKey.KeyType, keygen.DEFAULT_CERTIFICATE_VALIDITY_DAYS)...)
+		if len(incorrect) == 0 {
+			var err error
+			if privateKey, err = newKey.Generate(); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				log.Printf("can not generate key: %v", err.Error())
+				return
+			}
+			publicKey = privateKey.Public()
+		}
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	certificate, err := ca.issue(template, publicKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not issue certificate: %v", err.Error())
+		return
+	}
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	err = dbhelper.CreateIssuedCertificate(caKeyID, certificate.SerialNumber.Text(16), certificate.Subject.String(), string(certificatePEM), certificate.NotBefore, certificate.NotAfter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not record issued certificate: %v", err)
+		return
+	}
+
+	w.Write(certificatePEM)
+	if privateKey != nil {
+		privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			log.Printf("can not encode private key: %v", err.Error())
+			return
+		}
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	}
+}
+
+// ListCertificates - GET /ca/{id:[0-9]+}/certificates, authenticated
+// Path params:
+// - id : the id of a CA created with /ca belonging to the authenticated user
+// Returns:
+// - certificates issued by the CA, newest first, in JSON format:
+//   "certificates": [
+//     {
+//       "serialNumber": string, hexadecimal,
+//       "subject": string, RFC 2253 distinguished name,
+//       "issuedOn", "expiresOn": string, RFC 3339 date,
+//       "status": string: valid, expired or revoked,
+//       "revokedOn": string, RFC 3339 date, and "revocationReason": string, for revoked certificates,
+//       "certificate": string, PEM format
+//     },
+//     ...
+//   ]
+func ListCertificates(w http.ResponseWriter, r *http.Request) {
+	caKeyID, _, ok := findCertificateAuthority(w, r)
+	if !ok {
+		return
+	}
+
+	certificates, err := dbhelper.FindIssuedCertificates(caKeyID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not retrieve issued certificates: %v", err)
+		return
+	}
+
+	result := struct {
+		Certificates []issuedCertificate `json:"certificates"`
+	}{
+		Certificates: make([]issuedCertificate, 0, len(certificates)),
+	}
+	now := time.Now()
+	for _, certificate := range certificates {
+		result.Certificates = append(result.Certificates, newIssuedCertificate(certificate, now))
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize issued certificates to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// RevokeCertificate - POST /ca/{id:[0-9]+}/certificates/{serial:[0-9a-fA-F]+}/revoke, authenticated
+// Path params:
+// - id : the id of a CA created with /ca belonging to the authenticated user
+// - serial : hexadecimal serial number of a certificate issued by the CA
+// Params:
+// - reason : unspecified, keyCompromise, cACompromise, affiliationChanged, superseded, cessationOfOperation,
+//   certificateHold, privilegeWithdrawn or aACompromise (optional, defaults to unspecified)
+// Returns:
+// Status code 200 on success, 404 if the certificate does not exist or is already revoked
+func RevokeCertificate(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	caKeyID, _, ok := findCertificateAuthority(w, r)
+	if !ok {
+		return
+	}
+
+	serialNumber, ok := new(big.Int).SetString(mux.Vars(r)["serial"], 16)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid serial"))
+		return
+	}
+	reason := 0
+	if reasonValues, ok := r.PostForm["reason"]; ok {
+		if reason, ok = revocationReasons[reasonValues[0]]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("incorrect fields: reason"))
+			return
+		}
+	}
+
+	revoked, err := dbhelper.RevokeIssuedCertificate(caKeyID, serialNumber.Text(16), reason, time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not revoke certificate: %v", err)
+		return
+	}
+	if !revoked {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("certificate not found or already revoked"))
+	}
+}
+
+// CRL - GET /ca/{id:[0-9]+}/crl
+// Path params:
+// - id : the id of a CA created with /ca
+// Returns:
+// - certificate revocation list signed by the CA in PEM format ("X509 CRL"), valid for 7 days;
+//   status code 404 for CAs with an encrypted private key, which can not be unlocked without the passphrase
+func CRL(w http.ResponseWriter, r *http.Request) {
+	caKeyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key, err := dbhelper.FindKey(caKeyID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not retrieve key: %v", err)
+		return
+	}
+	if key == nil || key.Type != "X.509" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	ca, err := parseCertificateAuthority([]byte(key.Value))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := ca.unlock(nil); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	certificates, err := dbhelper.FindIssuedCertificates(caKeyID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not retrieve issued certificates: %v", err)
+		return
+	}
+	crl, err := ca.revocationList(certificates, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not create revocation list: %v", err.Error())
+		return
+	}
+	w.Write(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}))
+}
+
+// findCertificateAuthority loads the CA from the id path param, writing the error response on failure
+func findCertificateAuthority(w http.ResponseWriter, r *http.Request) (int, *certificateAuthority, bool) {
+	keyID := mux.Vars(r)["id"]
+	key, err := findStoredKey(r, keyID, "X.509")
+	if err == errKeyAuth {
+		w.WriteHeader(http.StatusUnauthorized)
+		return 0, nil, false
+	} else if err == errKeyID {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid CA"))
+		return 0, nil, false
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not retrieve key: %v", err.Error())
+		return 0, nil, false
+	}
+	ca, err := parseCertificateAuthority([]byte(key.Value))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid CA"))
+		return 0, nil, false
+	}
+	caKeyID, _ := strconv.Atoi(keyID)
+	return caKeyID, ca, true
+}
+
+// parseCertificateAuthority reads the first certificate of the PEM input, which must be a CA certificate;
+// its private key is read by unlock
+func parseCertificateAuthority(data []byte) (*certificateAuthority, error) {
+	var certificate *x509.Certificate
+	for rest := data; certificate == nil; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("can not decode certificate")
+		}
+		if block.Type == "CERTIFICATE" {
+			var err error
+			if certificate, err = x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !certificate.IsCA || certificate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.New("not a CA certificate")
+	}
+	return &certificateAuthority{certificate: certificate, data: data}, nil
+}
+
+// unlock reads the first private key of the PEM input, decrypting it with the passphrase if it is encrypted;
+// the key must match the certificate
+func (ca *certificateAuthority) unlock(passphrase []byte) error {
+	key, _, _, err := keygen.ParsePrivateKey(ca.data, passphrase)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(ca.certificate.PublicKey) {
+		return errors.New("private key does not match certificate")
+	}
+	ca.key = key
+	return nil
+}
+
+// parseCertificateRequest decodes a PEM certificate signing request and checks its signature
+func parseCertificateRequest(data []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+		return nil, errors.New("can not decode certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+// issue signs an end-entity certificate for the public key, its validity is capped at the expiry of the CA
+func (ca *certificateAuthority) issue(template *x509.Certificate, publicKey crypto.PublicKey) (*x509.Certificate, error) {
+	serialNumber, err := keygen.GenerateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serialNumber
+	template.IsCA = false
+	if template.NotAfter.After(ca.certificate.NotAfter) {
+		template.NotAfter = ca.certificate.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, publicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// revocationList creates a DER-encoded CRL of the revoked certificates, numbered by its creation time
+func (ca *certificateAuthority) revocationList(certificates []dbhelper.IssuedCertificate, now time.Time) ([]byte, error) {
+	now = now.UTC().Truncate(time.Second)
+	template := &x509.RevocationList{
+		Number:     big.NewInt(now.Unix()),
+		ThisUpdate: now,
+		NextUpdate: now.AddDate(0, 0, CRL_VALIDITY_DAYS),
+	}
+	for _, certificate := range certificates {
+		if certificate.RevokedOn == nil {
+			continue
+		}
+		serialNumber, ok := new(big.Int).SetString(certificate.SerialNumber, 16)
+		if !ok {
+			return nil, errors.New("invalid serial number " + certificate.SerialNumber)
+		}
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   serialNumber,
+			RevocationTime: *certificate.RevokedOn,
+			ReasonCode:     certificate.RevocationReason,
+		})
+	}
+	return x509.CreateRevocationList(rand.Reader, template, ca.certificate, ca.key)
+}
+
+// newIssuedCertificate converts the stored certificate to its JSON representation
+func newIssuedCertificate(certificate dbhelper.IssuedCertificate, now time.Time) issuedCertificate {
+	result := issuedCertificate{
+		SerialNumber: certificate.SerialNumber,
+		Subject:      certificate.Subject,
+		IssuedOn:     certificate.IssuedOn,
+		ExpiresOn:    certificate.ExpiresOn,
+		Status:       "valid",
+		RevokedOn:    certificate.RevokedOn,
+		Certificate:  certificate.Certificate,
+	}
+	if certificate.RevokedOn != nil {
+		result.Status = "revoked"
+		for name, code := range revocationReasons {
+			if code == certificate.RevocationReason {
+				result.RevocationReason = name
+			}
+		}
+	} else if now.After(certificate.ExpiresOn) {
+		result.Status = "expired"
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"../dbhelper"
+	"../keygen"
+)
+
+func TestCertificateAuthorityIssue(t *testing.T) {
+	ca := newTestCertificateAuthority(t)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "www.example.com"},
+		DNSNames:              []string{"www.example.com"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(20, 0, 0),
+	}
+	certificate, err := ca.issue(template, &leafKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := certificate.CheckSignatureFrom(ca.certificate); err != nil {
+		t.Errorf("issued certificate is not signed by the CA: %v", err)
+	}
+	if certificate.IsCA {
+		t.Errorf("issued certificate is a CA certificate")
+	}
+	if !certificate.NotAfter.Equal(ca.certificate.NotAfter) {
+		t.Errorf("issued certificate outlives the CA: got: %v, expected: %v", certificate.NotAfter, ca.certificate.NotAfter)
+	}
+	if certificate.Issuer.CommonName != "Test CA" {
+		t.Errorf("issued certificate has incorrect issuer: %v", certificate.Issuer)
+	}
+}
+
+func TestCertificateAuthorityRevocationList(t *testing.T) {
+	ca := newTestCertificateAuthority(t)
+
+	revokedOn := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	certificates := []dbhelper.IssuedCertificate{
+		{SerialNumber: "1f"},
+		{SerialNumber: "2a", RevokedOn: &revokedOn, RevocationReason: revocationReasons["keyCompromise"]},
+	}
+	der, err := ca.revocationList(certificates, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := crl.CheckSignatureFrom(ca.certificate); err != nil {
+		t.Errorf("revocation list is not signed by the CA: %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("revocation list has incorrect entry count: got: %v, expected: 1", len(crl.RevokedCertificateEntries))
+	}
+	entry := crl.RevokedCertificateEntries[0]
+	if entry.SerialNumber.Cmp(big.NewInt(0x2a)) != 0 || entry.ReasonCode != 1 || !entry.RevocationTime.Equal(revokedOn) {
+		t.Errorf("revocation list has incorrect entry: %v %v %v", entry.SerialNumber, entry.ReasonCode, entry.RevocationTime)
+	}
+	if crl.NextUpdate.Sub(crl.ThisUpdate) != CRL_VALIDITY_DAYS*24*time.Hour {
+		t.Errorf("revocation list has incorrect validity: %v - %v", crl.ThisUpdate, crl.NextUpdate)
+	}
+}
+
+func TestParseCertificateAuthorityNotCA(t *testing.T) {
+	rr := postForm(t, keygen.SelfSignedCertificate, "/x509/self-signed", url.Values{"commonName": {"example.com"}})
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("SelfSignedCertificate returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	if _, err := parseCertificateAuthority(rr.Body.Bytes()); err == nil {
+		t.Errorf("parseCertificateAuthority accepted an end-entity certificate")
+	}
+
+	rr = postForm(t, keygen.SelfSignedCertificate, "/x509/self-signed", url.Values{"commonName": {"Test CA"}, "isCA": {"true"}})
+	if _, err := parseCertificateAuthority(rr.Body.Bytes()); err != nil {
+		t.Errorf("parseCertificateAuthority rejected a CA certificate: %v", err)
+	}
+}
+
+func TestCertificateAuthorityEncryptedKey(t *testing.T) {
+	rr := postForm(t, keygen.SelfSignedCertificate, "/x509/self-signed", url.Values{"commonName": {"Test CA"}, "isCA": {"true"}})
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("SelfSignedCertificate returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	certificate, rest := pem.Decode(rr.Body.Bytes())
+	key, _, _, err := keygen.ParsePrivateKey(rest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := keygen.MarshalEncryptedPKCS8PrivateKey(key, []byte("cadmium"), "pbkdf2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(pem.EncodeToMemory(certificate), pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted})...)
+
+	ca, err := parseCertificateAuthority(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.unlock(nil); err != keygen.ErrEncryptedKey {
+		t.Errorf("unlock returned unexpected error without a passphrase: %v", err)
+	}
+	if err := ca.unlock([]byte("wrong")); err != keygen.ErrIncorrectPassphrase {
+		t.Errorf("unlock returned unexpected error for an incorrect passphrase: %v", err)
+	}
+	if err := ca.unlock([]byte("cadmium")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.issue(&x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}}, key.Public()); err != nil {
+		t.Errorf("issue failed with an unlocked CA: %v", err)
+	}
+}
+
+func TestNewIssuedCertificateStatus(t *testing.T) {
+	now := time.Now()
+	revokedOn := now.Add(-time.Hour)
+	statuses := []struct {
+		certificate dbhelper.IssuedCertificate
+		status      string
+		reason      string
+	}{
+		{dbhelper.IssuedCertificate{ExpiresOn: now.Add(time.Hour)}, "valid", ""},
+		{dbhelper.IssuedCertificate{ExpiresOn: now.Add(-time.Hour)}, "expired", ""},
+		{dbhelper.IssuedCertificate{ExpiresOn: now.Add(time.Hour), RevokedOn: &revokedOn, RevocationReason: 4}, "revoked", "superseded"},
+	}
+	for _, s := range statuses {
+		result := newIssuedCertificate(s.certificate, now)
+		if result.Status != s.status || result.RevocationReason != s.reason {
+			t.Errorf("newIssuedCertificate returned incorrect status: got: %v %v, expected: %v %v", result.Status, result.RevocationReason, s.status, s.reason)
+		}
+	}
+}
+
+func TestCreateCAUnauthenticated(t *testing.T) {
+	rr := postForm(t, CreateCA, "/ca", url.Values{"name": {"Test CA"}, "commonName": {"Test CA"}})
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("CreateCA returned incorrect status code: got: %v, expected: %v", status, http.StatusUnauthorized)
+	}
+}
+
+func newTestCertificateAuthority(t *testing.T) *certificateAuthority {
+	rr := postForm(t, keygen.SelfSignedCertificate, "/x509/self-signed", url.Values{"commonName": {"Test CA"}, "isCA": {"true"}, "validity": {"30"}})
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("SelfSignedCertificate returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	ca, err := parseCertificateAuthority(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.unlock(nil); err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
@@ -0,0 +1,259 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"../auth"
+	"../dbhelper"
+	"../keygen"
+)
+
+var errKeyAuth = errors.New("pki: stored keys require authentication")
+
+var errKeyID = errors.New("pki: key not found or not a private key")
+
+// CreateCSR - POST /x509/csr, optionally authenticated
+// Params:
+// - key : private key, PEM (PKCS #1, PKCS #8, encrypted PKCS #8, SEC 1, OpenSSH), base64 or hex DER or JWK;
+//   other PEM blocks, e.g. a public key, are skipped
+// - keyID : id of a stored RSA, ECDSA or X.509 key to use instead of key, requires authentication
+// - passphrase : passphrase of an encrypted PKCS #8 or OpenSSH private key, given or stored (optional)
+// - commonName : non-empty string
+// - organization, organizationalUnit, country, province, locality : subject fields (optional)
+// - dnsNames : DNS subject alternative name, may be repeated (optional)
+// - ipAddresses : IPv4 or IPv6 subject alternative name, may be repeated (optional)
+// Returns:
+// - PKCS #10 certificate signing request in PEM format ("CERTIFICATE REQUEST")
+func CreateCSR(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	key, ok := parseSigningKey(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := r.PostForm["commonName"]; !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field commonName"))
+		return
+	}
+
+	subject, incorrect := keygen.ParseSubject(r)
+	dnsNames, ipAddresses, incorrectNames := keygen.ParseSubjectAlternativeNames(r)
+	incorrect = append(incorrect, incorrectNames...)
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	template := &x509.CertificateRequest{Subject: subject, DNSNames: dnsNames, IPAddresses: ipAddresses}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not create certificate request: %v", err.Error())
+		return
+	}
+	w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+}
+
+// ParseCSR - POST /x509/csr/parse
+// Params:
+// - csr : PKCS #10 certificate signing request in PEM format
+// Returns:
+// - certificate signing request contents in JSON format:
+//   "subject": string, RFC 2253 distinguished name,
+//   "commonName": string, "organization", "organizationalUnit", "country", "province", "locality": [ string, ... ],
+//   "dnsNames", "ipAddresses", "emailAddresses", "uris": [ string, ... ],
+//   "publicKeyAlgorithm": string, "publicKeySize": integer, bits, "curve": string, for ECDSA keys,
+//   "publicKeyFingerprint": string, hex-encoded SHA-256 of the SubjectPublicKeyInfo,
+//   "signatureAlgorithm": string,
+//   "signatureValid": boolean
+func ParseCSR(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	csrValues, ok := r.PostForm["csr"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field csr"))
+		return
+	}
+	block, _ := pem.Decode([]byte(csrValues[0]))
+	if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid csr"))
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid csr"))
+		return
+	}
+
+	result := struct {
+		Subject              string   `json:"subject"`
+		CommonName           string   `json:"commonName"`
+		Organization         []string `json:"organization"`
+		OrganizationalUnit   []string `json:"organizationalUnit"`
+		Country              []string `json:"country"`
+		Province             []string `json:"province"`
+		Locality             []string `json:"locality"`
+		DNSNames             []string `json:"dnsNames"`
+		IPAddresses          []string `json:"ipAddresses"`
+		EmailAddresses       []string `json:"emailAddresses"`
+		URIs                 []string `json:"uris"`
+		PublicKeyAlgorithm   string   `json:"publicKeyAlgorithm"`
+		PublicKeySize        int      `json:"publicKeySize"`
+		Curve                string   `json:"curve,omitempty"`
+		PublicKeyFingerprint string   `json:"publicKeyFingerprint"`
+		SignatureAlgorithm   string   `json:"signatureAlgorithm"`
+		SignatureValid       bool     `json:"signatureValid"`
+	}{
+		Subject:            csr.Subject.String(),
+		CommonName:         csr.Subject.CommonName,
+		Organization:       nonNil(csr.Subject.Organization),
+		OrganizationalUnit: nonNil(csr.Subject.OrganizationalUnit),
+		Country:            nonNil(csr.Subject.Country),
+		Province:           nonNil(csr.Subject.Province),
+		Locality:           nonNil(csr.Subject.Locality),
+		DNSNames:           nonNil(csr.DNSNames),
+		IPAddresses:        make([]string, 0, len(csr.IPAddresses)),
+		EmailAddresses:     nonNil(csr.EmailAddresses),
+		URIs:               make([]string, 0, len(csr.URIs)),
+		PublicKeyAlgorithm: csr.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: csr.SignatureAlgorithm.String(),
+		SignatureValid:     csr.CheckSignature() == nil,
+	}
+	for _, ip := range csr.IPAddresses {
+		result.IPAddresses = append(result.IPAddresses, ip.String())
+	}
+	for _, uri := range csr.URIs {
+		result.URIs = append(result.URIs, uri.String())
+	}
+	switch publicKey := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		result.PublicKeySize = publicKey.N.BitLen()
+	case *ecdsa.PublicKey:
+		result.PublicKeySize = publicKey.Curve.Params().BitSize
+		result.Curve = publicKey.Curve.Params().Name
+	case ed25519.PublicKey:
+		result.PublicKeySize = 256
+	}
+	fingerprint := sha256.Sum256(csr.RawSubjectPublicKeyInfo)
+	result.PublicKeyFingerprint = hex.EncodeToString(fingerprint[:])
+
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize certificate request to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// parseSigningKey reads the private key from either the key or the keyID field, writing the error response on failure
+func parseSigningKey(w http.ResponseWriter, r *http.Request) (crypto.Signer, bool) {
+	passphrase := []byte(r.PostForm.Get("passphrase"))
+	if keyIDValues, ok := r.PostForm["keyID"]; ok {
+		key, err := findStoredPrivateKey(r, keyIDValues[0], passphrase)
+		if err == errKeyAuth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil, false
+		} else if err == errKeyID {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid keyID"))
+			return nil, false
+		} else if keygen.IsPassphraseError(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return nil, false
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("can not retrieve key: %v", err.Error())
+			return nil, false
+		}
+		return key, true
+	}
+
+	keyValues, ok := r.PostForm["key"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field key"))
+		return nil, false
+	}
+	key, _, _, err := keygen.ParsePrivateKey([]byte(keyValues[0]), passphrase)
+	if keygen.IsPassphraseError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil, false
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid key"))
+		return nil, false
+	}
+	return key, true
+}
+
+// findStoredPrivateKey returns the private key of a stored key, decrypting it with the passphrase if it is encrypted
+func findStoredPrivateKey(r *http.Request, keyID string, passphrase []byte) (crypto.Signer, error) {
+	key, err := findStoredKey(r, keyID, "RSA", "ECDSA", "X.509")
+	if err != nil {
+		return nil, err
+	}
+	return parseStoredPrivateKey(key, passphrase)
+}
+
+// parseStoredPrivateKey returns the first private key of a stored key, decrypting it with the passphrase if it is encrypted
+func parseStoredPrivateKey(key *dbhelper.Key, passphrase []byte) (crypto.Signer, error) {
+	privateKey, _, _, err := keygen.ParsePrivateKey([]byte(key.Value), passphrase)
+	if keygen.IsPassphraseError(err) {
+		return nil, err
+	} else if err != nil {
+		return nil, errKeyID
+	}
+	return privateKey, nil
+}
+
+// findStoredKey returns the key with the given id if it belongs to the authenticated user and has one of the key types
+func findStoredKey(r *http.Request, keyID string, keyTypes ...string) (*dbhelper.Key, error) {
+	userID, ok := auth.UserID(r)
+	if !ok {
+		return nil, errKeyAuth
+	}
+
+	id, err := strconv.Atoi(keyID)
+	if err != nil {
+		return nil, errKeyID
+	}
+	key, err := dbhelper.FindOwnedKey(id, userID, keyTypes...)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errKeyID
+	}
+	return key, nil
+}
+
+// nonNil returns an empty slice instead of nil, so that it is serialized as an empty JSON array
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
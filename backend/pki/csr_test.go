@@ -0,0 +1,147 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"../keygen"
+)
+
+func TestCreateCSR(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDER}))
+
+	payload := url.Values{
+		"key":          {key},
+		"commonName":   {"www.example.com"},
+		"organization": {"Example"},
+		"dnsNames":     {"www.example.com", "example.com"},
+		"ipAddresses":  {"192.0.2.1"},
+	}
+	rr := postForm(t, CreateCSR, "/x509/csr", payload)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("CreateCSR returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	csr := rr.Body.String()
+
+	rr = postForm(t, ParseCSR, "/x509/csr/parse", url.Values{"csr": {csr}})
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("ParseCSR returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	var result struct {
+		Subject            string   `json:"subject"`
+		CommonName         string   `json:"commonName"`
+		DNSNames           []string `json:"dnsNames"`
+		IPAddresses        []string `json:"ipAddresses"`
+		PublicKeyAlgorithm string   `json:"publicKeyAlgorithm"`
+		PublicKeySize      int      `json:"publicKeySize"`
+		Curve              string   `json:"curve"`
+		SignatureAlgorithm string   `json:"signatureAlgorithm"`
+		SignatureValid     bool     `json:"signatureValid"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Subject != "CN=www.example.com,O=Example" || result.CommonName != "www.example.com" {
+		t.Errorf("ParseCSR returned incorrect subject: %v", result.Subject)
+	}
+	if len(result.DNSNames) != 2 || len(result.IPAddresses) != 1 || result.IPAddresses[0] != "192.0.2.1" {
+		t.Errorf("ParseCSR returned incorrect subject alternative names: %v %v", result.DNSNames, result.IPAddresses)
+	}
+	if result.PublicKeyAlgorithm != "ECDSA" || result.PublicKeySize != 384 || result.Curve != "P-384" {
+		t.Errorf("ParseCSR returned incorrect public key details: %v %v %v", result.PublicKeyAlgorithm, result.PublicKeySize, result.Curve)
+	}
+	if !result.SignatureValid || result.SignatureAlgorithm != "ECDSA-SHA384" {
+		t.Errorf("ParseCSR returned incorrect signature details: %v %v", result.SignatureAlgorithm, result.SignatureValid)
+	}
+}
+
+func TestParseCSRInvalidSignature(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the signature is the last element of the request, flipping its last byte breaks it
+	csr[len(csr)-1] ^= 1
+
+	rr := postForm(t, ParseCSR, "/x509/csr/parse", url.Values{"csr": {string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))}})
+	if body := rr.Body.String(); !strings.Contains(body, `"signatureValid":false`) {
+		t.Errorf("ParseCSR did not detect the invalid signature: %v", body)
+	}
+}
+
+func TestCreateCSRStoredKeyUnauthenticated(t *testing.T) {
+	rr := postForm(t, CreateCSR, "/x509/csr", url.Values{"keyID": {"1"}, "commonName": {"example.com"}})
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("CreateCSR returned incorrect status code: got: %v, expected: %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestCreateCSRInvalidKey(t *testing.T) {
+	rr := postForm(t, CreateCSR, "/x509/csr", url.Values{"key": {"-----BEGIN PUBLIC KEY-----\n-----END PUBLIC KEY-----\n"}, "commonName": {"example.com"}})
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("CreateCSR returned incorrect status code: got: %v, expected: %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestCreateCSREncryptedKey(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := keygen.MarshalEncryptedPKCS8PrivateKey(privateKey, []byte("cadmium"), "pbkdf2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}))
+
+	rr := postForm(t, CreateCSR, "/x509/csr", url.Values{"key": {key}, "commonName": {"example.com"}})
+	if body := rr.Body.String(); rr.Code != http.StatusBadRequest || body != keygen.ErrEncryptedKey.Error() {
+		t.Errorf("CreateCSR returned incorrect response without a passphrase: %v %v", rr.Code, body)
+	}
+
+	rr = postForm(t, CreateCSR, "/x509/csr", url.Values{"key": {key}, "passphrase": {"cadmium"}, "commonName": {"example.com"}})
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("CreateCSR returned incorrect status code: got: %v, expected: %v", status, http.StatusOK)
+	}
+	block, _ := pem.Decode(rr.Body.Bytes())
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !privateKey.PublicKey.Equal(csr.PublicKey) {
+		t.Error("CreateCSR signed the request with an incorrect key")
+	}
+}
+
+func postForm(t *testing.T, handlerFunc http.HandlerFunc, path string, payload url.Values) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", path, strings.NewReader(payload.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handlerFunc.ServeHTTP(rr, req)
+	return rr
+}
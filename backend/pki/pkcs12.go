@@ -0,0 +1,347 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"../auth"
+	"../dbhelper"
+	"../keygen"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// MAX_PKCS12_SIZE bounds uploaded PKCS #12 files, which hold a key and a handful of certificates
+const MAX_PKCS12_SIZE = 1 << 20
+
+var errNoMatchingCertificate = errors.New("no certificate matches the private key")
+
+// pkcs12Encoders maps the encryption param to the PKCS #12 encoders
+var pkcs12Encoders = map[string]*pkcs12.Encoder{
+	"modern": pkcs12.Modern,
+	"legacy": pkcs12.Legacy,
+}
+
+var unsafeFilenameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// importedKey is a key store entry created from a PKCS #12 file in JSON format
+type importedKey struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Subject string `json:"subject,omitempty"`
+}
+
+// ExportPKCS12 - POST /pkcs12/export, authenticated
+// Params:
+// - keyID : id of a stored X.509 key holding a certificate and private key, or of a stored RSA or ECDSA key
+// - passphrase : passphrase of the stored private key if it is an encrypted PKCS #8 or OpenSSH key (optional)
+// - certificateID : id of a stored X.509 key holding a certificate of the chain, may be repeated (optional)
+// - certificates : certificates of the chain in PEM format (optional)
+// - password : non-empty password protecting the PKCS #12 file
+// - encryption : modern (AES-256 and PBKDF2-HMAC-SHA256 with a SHA-256 MAC, for OpenSSL 3, Java 12 and Windows
+//   Server 2019 or later) or legacy (3DES with a SHA-1 MAC, for older Java and Windows versions)
+//   (optional, defaults to modern)
+// Returns:
+// - PKCS #12 file as an application/x-pkcs12 attachment; the certificate matching the private key is the end-entity
+//   certificate, the other certificates are included as its chain in the given order
+func ExportPKCS12(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	if _, ok := auth.UserID(r); !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	missing := make([]string, 0, 2)
+	keyIDValues, ok := r.PostForm["keyID"]
+	if !ok {
+		missing = append(missing, "keyID")
+	}
+	passwordValues, ok := r.PostForm["password"]
+	if !ok {
+		missing = append(missing, "password")
+	}
+	if len(missing) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing fields: " + strings.Join(missing, ", ")))
+		return
+	}
+
+	incorrect := make([]string, 0, 3)
+	password := passwordValues[0]
+	if len(password) == 0 {
+		incorrect = append(incorrect, "password")
+	}
+	encryption := "modern"
+	if encryptionValues, ok := r.PostForm["encryption"]; ok {
+		encryption = encryptionValues[0]
+		if _, ok := pkcs12Encoders[encryption]; !ok {
+			incorrect = append(incorrect, "encryption")
+		}
+	}
+	chain, err := parseCertificates([]byte(r.PostForm.Get("certificates")))
+	if _, ok := r.PostForm["certificates"]; ok && (err != nil || len(chain) == 0) {
+		incorrect = append(incorrect, "certificates")
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	key, err := findStoredKey(r, keyIDValues[0], "RSA", "ECDSA", "X.509")
+	if err == errKeyID {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyID"))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not retrieve key: %v", err.Error())
+		return
+	}
+	privateKey, err := parseStoredPrivateKey(key, []byte(r.PostForm.Get("passphrase")))
+	if keygen.IsPassphraseError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyID"))
+		return
+	}
+	certificates, err := parseCertificates([]byte(key.Value))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid keyID"))
+		return
+	}
+	for _, certificateID := range r.PostForm["certificateID"] {
+		stored, err := findStoredKey(r, certificateID, "X.509")
+		if err == errKeyID {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid certificateID"))
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("can not retrieve key: %v", err.Error())
+			return
+		}
+		storedCertificates, err := parseCertificates([]byte(stored.Value))
+		if err != nil || len(storedCertificates) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid certificateID"))
+			return
+		}
+		certificates = append(certificates, storedCertificates...)
+	}
+	certificates = append(certificates, chain...)
+
+	pfx, err := encodePKCS12(privateKey, certificates, password, pkcs12Encoders[encryption])
+	if err == errNoMatchingCertificate {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not encode PKCS #12 file: %v", err.Error())
+		return
+	}
+
+	filename := strings.Trim(unsafeFilenameCharacters.ReplaceAllString(key.Name, "_"), "_.")
+	if filename == "" {
+		filename = "keystore"
+	}
+	w.Header().Set("Content-Type", "application/x-pkcs12")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+".p12\"")
+	w.Write(pfx)
+}
+
+// ImportPKCS12 - POST /pkcs12/import, authenticated, multipart/form-data
+// Params:
+// - file : PKCS #12 (.p12 / .pfx) file holding a private key and its certificate chain, at most 1 MiB
+// - password : password of the PKCS #12 file, may be empty
+// - name : name of the stored private key; certificates are stored as "<name> certificate" for the end-entity
+//   certificate and "<name> chain certificate <n>" for the others
+// Returns:
+// - the stored entries in JSON format:
+//   "key": { "id": integer, "name": string, "type": RSA or ECDSA },
+//   "certificates": [ { "id": integer, "name": string, "type": X.509, "subject": string }, ... ]
+func ImportPKCS12(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 2*MAX_PKCS12_SIZE)
+	if err := r.ParseMultipartForm(MAX_PKCS12_SIZE); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid multipart form"))
+		return
+	}
+
+	userID, ok := auth.UserID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	missing := make([]string, 0, 3)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		missing = append(missing, "file")
+	} else {
+		defer file.Close()
+	}
+	passwordValues, ok := r.PostForm["password"]
+	if !ok {
+		missing = append(missing, "password")
+	}
+	nameValues, ok := r.PostForm["name"]
+	if !ok {
+		missing = append(missing, "name")
+	}
+	if len(missing) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing fields: " + strings.Join(missing, ", ")))
+		return
+	}
+
+	if header.Size > MAX_PKCS12_SIZE {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: file"))
+		return
+	}
+	pfx, err := ioutil.ReadAll(file)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: file"))
+		return
+	}
+	entries, err := splitPKCS12(pfx, passwordValues[0], nameValues[0])
+	if err == pkcs12.ErrIncorrectPassword {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: password"))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: file"))
+		return
+	}
+	names := make([]string, len(entries))
+	values := make([]string, len(entries))
+	keyTypes := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i], values[i], keyTypes[i] = entry.Name, entry.value, entry.Type
+	}
+	if len(nameValues[0]) == 0 || len(names[len(names)-1]) > 100 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: name"))
+		return
+	}
+
+	ids, err := dbhelper.CreateKeys(names, values, keyTypes, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not create keys: %v", err)
+		return
+	}
+	stored := make([]importedKey, len(entries))
+	for i, entry := range entries {
+		stored[i] = importedKey{ID: ids[i], Name: entry.Name, Type: entry.Type, Subject: entry.Subject}
+	}
+
+	result := struct {
+		Key          importedKey   `json:"key"`
+		Certificates []importedKey `json:"certificates"`
+	}{stored[0], stored[1:]}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize keys to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// pkcs12Entry is a key store entry split from a PKCS #12 file
+type pkcs12Entry struct {
+	importedKey
+	value string
+}
+
+// encodePKCS12 picks the certificate matching the private key as the end-entity certificate and encodes the others
+// as its chain
+func encodePKCS12(key crypto.Signer, certificates []*x509.Certificate, password string, encoder *pkcs12.Encoder) ([]byte, error) {
+	publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	for i, certificate := range certificates {
+		if publicKey.Equal(certificate.PublicKey) {
+			chain := make([]*x509.Certificate, 0, len(certificates)-1)
+			chain = append(append(chain, certificates[:i]...), certificates[i+1:]...)
+			return encoder.Encode(key, certificate, chain, password)
+		}
+	}
+	return nil, errNoMatchingCertificate
+}
+
+// splitPKCS12 decodes the PKCS #12 file into the private key entry followed by the certificate entries
+func splitPKCS12(pfx []byte, password, name string) ([]pkcs12Entry, error) {
+	privateKey, certificate, chain, err := pkcs12.DecodeChain(pfx, password)
+	if err != nil {
+		return nil, err
+	}
+	var keyType string
+	switch privateKey.(type) {
+	case *rsa.PrivateKey:
+		keyType = "RSA"
+	case *ecdsa.PrivateKey:
+		keyType = "ECDSA"
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+	encoded, err := keygen.EncodeKeyPair(privateKey.(crypto.Signer), "pkcs8")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]pkcs12Entry, 0, len(chain)+2)
+	entries = append(entries, pkcs12Entry{importedKey{Name: name, Type: keyType}, string(encoded)})
+	for i, c := range append([]*x509.Certificate{certificate}, chain...) {
+		certificateName := name + " certificate"
+		if i > 0 {
+			certificateName = name + " chain certificate " + strconv.Itoa(i)
+		}
+		value := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+		entries = append(entries, pkcs12Entry{importedKey{Name: certificateName, Type: "X.509", Subject: c.Subject.String()}, value})
+	}
+	return entries, nil
+}
+
+// parseCertificates returns all certificates of the PEM input, skipping other PEM blocks
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certificates := make([]*x509.Certificate, 0, 2)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certificates, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+}
@@ -0,0 +1,165 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"../keygen"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// opensslPKCS12 is an ECDSA P-256 key with a self-signed certificate for p12.example.com, exported by OpenSSL 3
+// with the password changeit
+const opensslPKCS12 = `
+MIIEHAIBAzCCA9IGCSqGSIb3DQEHAaCCA8MEggO/MIIDuzCCAnIGCSqGSIb3DQEH
+BqCCAmMwggJfAgEAMIICWAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqG
+SIb3DQEFDDAcBAiUeKoRrKiXFQICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQME
+ASoEECjsA9iF0gfE8y1NjKZN8/mAggHwBE14quBQ4g1JsrSqQUljVvxGsp2Nn8dS
+ESD2nq/nqMrcRanssbLuEnf2naI4S2HaoqJkVnniEeBH9OPDqaCwoPOiqcNqMPfi
+s1R2dH/p+x/UTklKawySBblvgrNheARhNS4KstoxKD15j0gZl1N6e1KZfY1m8oqj
+jxQcGDHCnoIBAryg+GLCvtt/E4mn4RJIPX7QMem5m2ATYIvplGuh6obu6qjGYtgL
+KUpCAUiTEid0GN4qLTHm3cyyT/qR520SXijgOQwXkuUdIrlciW2xQQx0gx8x/nGH
+gyEbw+LxYMLaVlXrbAteO0E8HEmI4R5NdWW175laC9Q9Q7uaIkJpysQvirjaYZIL
+XdoLO/jZPYs0pHvkDMqCuhArL3UnDd/gvs+nP1f0ybPIUm1C/oIZGBLpR31kABLb
+npzua4WrfNHWdTlGZ4MhUDM56kWhnfolo0tvVEkmc5eEvfZFUEiV/dn7zSff8At2
+vvosblxKITxkbLSaoxLybslY0TC+zw2GXGf6iSk4ARdOb6OcD2CXpbWUD5OE3o8B
+HKR4ztqzRPAywQnbQE45XzYTk9XfweNWQ7gOUxb1lzQ8GYoqJqQ3uKybfnnz8u0U
+vTJilyaA3AhK6YJANuyscNtVqsLSVAD0WCWWgOfIj/vSYRlKVOLkZTCCAUEGCSqG
+SIb3DQEHAaCCATIEggEuMIIBKjCCASYGCyqGSIb3DQEMCgECoIHvMIHsMFcGCSqG
+SIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAjlnuP9Wj+rOwICCAAwDAYIKoZIhvcN
+AgkFADAdBglghkgBZQMEASoEELfBn/YY1Pj1v1PcXpvvlpoEgZAFlUEdPqY6WXcC
+qNQ/yWFjBTe2fn1SsOT6vt1KWaq04D4Iz31qoizP/VexziVNDl23ys9UKre67oar
+gY0GwZrKUy28hKxRefQtwX91Knww5LY7r2SbPY+mURXd5A5GMrWDv+5LmBgVu3OK
+IUl5rZs6eptsqSbGKzNP9HXdQ6LAWxIpYwawHHLM/lFlJuhmijAxJTAjBgkqhkiG
+9w0BCRUxFgQUhyAffhk8yx3J/WPUE6pbCBtuLmowQTAxMA0GCWCGSAFlAwQCAQUA
+BCBGGCD5zzv6Wp6hfeMONOcC9FdDJVn+mIDeV2qiYXIvewQIJsMlOB558UgCAggA
+`
+
+func TestPKCS12RoundTrip(t *testing.T) {
+	ca := newTestCertificateAuthority(t)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "www.example.com"},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().AddDate(1, 0, 0),
+	}
+	leaf, err := ca.issue(template, &leafKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for encryption, encoder := range pkcs12Encoders {
+		// the end-entity certificate is picked by its key, whatever its position
+		pfx, err := encodePKCS12(leafKey, []*x509.Certificate{ca.certificate, leaf}, "changeit", encoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := splitPKCS12(pfx, "changeit", "www")
+		if err != nil {
+			t.Fatalf("splitPKCS12 can not decode %v file: %v", encryption, err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("splitPKCS12 returned incorrect entry count: got: %v, expected: 3", len(entries))
+		}
+		if entries[0].Name != "www" || entries[0].Type != "ECDSA" {
+			t.Errorf("splitPKCS12 returned incorrect key entry: %v %v", entries[0].Name, entries[0].Type)
+		}
+		key, _, _, err := keygen.ParsePrivateKey([]byte(entries[0].value), nil)
+		if err != nil || !leafKey.Equal(key) {
+			t.Errorf("splitPKCS12 returned incorrect private key: %v", err)
+		}
+		if entries[1].Name != "www certificate" || entries[1].Subject != "CN=www.example.com" {
+			t.Errorf("splitPKCS12 returned incorrect certificate entry: %v %v", entries[1].Name, entries[1].Subject)
+		}
+		if entries[2].Name != "www chain certificate 1" || entries[2].Subject != "CN=Test CA" || entries[2].Type != "X.509" {
+			t.Errorf("splitPKCS12 returned incorrect chain entry: %v %v %v", entries[2].Name, entries[2].Subject, entries[2].Type)
+		}
+		if _, err := splitPKCS12(pfx, "incorrect", "www"); err != pkcs12.ErrIncorrectPassword {
+			t.Errorf("splitPKCS12 returned incorrect error for an incorrect password: %v", err)
+		}
+	}
+}
+
+func TestEncodePKCS12NoMatchingCertificate(t *testing.T) {
+	ca := newTestCertificateAuthority(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encodePKCS12(key, []*x509.Certificate{ca.certificate}, "changeit", pkcs12.Modern); err != errNoMatchingCertificate {
+		t.Errorf("encodePKCS12 returned incorrect error: got: %v, expected: %v", err, errNoMatchingCertificate)
+	}
+}
+
+func TestSplitOpenSSLPKCS12(t *testing.T) {
+	pfx, err := base64.StdEncoding.DecodeString(strings.Replace(opensslPKCS12, "\n", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := splitPKCS12(pfx, "changeit", "openssl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Type != "ECDSA" || entries[1].Subject != "CN=p12.example.com" {
+		t.Fatalf("splitPKCS12 returned incorrect entries: %v", entries)
+	}
+	certificates, err := parseCertificates([]byte(entries[1].value))
+	if err != nil || len(certificates) != 1 {
+		t.Fatalf("splitPKCS12 returned incorrect certificate: %v", err)
+	}
+	key, _, _, err := keygen.ParsePrivateKey([]byte(entries[0].value), nil)
+	if err != nil || !key.Public().(*ecdsa.PublicKey).Equal(certificates[0].PublicKey) {
+		t.Errorf("splitPKCS12 returned a private key not matching the certificate: %v", err)
+	}
+}
+
+func TestExportPKCS12Unauthenticated(t *testing.T) {
+	rr := postForm(t, ExportPKCS12, "/pkcs12/export", url.Values{"keyID": {"1"}, "password": {"changeit"}})
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("ExportPKCS12 returned incorrect status code: got: %v, expected: %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestImportPKCS12Unauthenticated(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("password", "changeit")
+	writer.WriteField("name", "openssl")
+	part, err := writer.CreateFormFile("file", "openssl.p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(opensslPKCS12))
+	writer.Close()
+
+	req, err := http.NewRequest("POST", "/pkcs12/import", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(ImportPKCS12).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("ImportPKCS12 returned incorrect status code: got: %v, expected: %v", status, http.StatusUnauthorized)
+	}
+
+	rr = postForm(t, ImportPKCS12, "/pkcs12/import", url.Values{"password": {"changeit"}})
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("ImportPKCS12 returned incorrect status code for a non-multipart request: got: %v, expected: %v", status, http.StatusBadRequest)
+	}
+}
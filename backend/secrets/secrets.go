@@ -0,0 +1,345 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"../dbhelper"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/scrypt"
+)
+
+const DEFAULT_TTL = 24 * 60 * 60
+
+const MAX_TTL = 7 * 24 * 60 * 60
+
+const MAX_SECRET_LENGTH = 32 * 1024
+
+// MAX_PASSPHRASE_ATTEMPTS wrong passphrases destroy a secret, bounding the guesses and their scrypt work
+const MAX_PASSPHRASE_ATTEMPTS = 5
+
+var errWrongPassphrase = errors.New("secrets: wrong passphrase")
+
+// database access, replaced in tests
+var (
+	findSecret            = dbhelper.FindSecret
+	deleteSecret          = dbhelper.DeleteSecret
+	countSecretAttempt    = dbhelper.CountSecretAttempt
+	deleteExhaustedSecret = dbhelper.DeleteExhaustedSecret
+)
+
+// CreateSecret - POST /secrets
+// The server encrypts the secret under a fresh random key and discards the key, which is only returned in the link;
+// the plain secret is seen by the server during this request, but neither the secret nor the key is stored.
+// Browsers do not send the URL fragment, so revealing fetches the encrypted secret and decrypts it client-side.
+// Params:
+// - secret: non-empty string of up to 32768 bytes, e.g. a password generated by /password
+// - ttl: positive integer, seconds until the secret expires (optional, defaults to 86400, at most 604800)
+// - passphrase: string required in addition to the link to reveal the secret (optional)
+// Returns:
+// - secret details in JSON format:
+//   "id": string,
+//   "key": string, base64url-encoded,
+//   "link": string, "/secrets/{id}#{key}", path of the frontend reveal page,
+//   "expiresOn": string, RFC 3339 time
+func CreateSecret(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	secretValues, ok := r.PostForm["secret"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing field secret"))
+		return
+	}
+
+	incorrect := make([]string, 0, 2)
+	secret := secretValues[0]
+	if len(secret) == 0 || len(secret) > MAX_SECRET_LENGTH {
+		incorrect = append(incorrect, "secret")
+	}
+	ttl := DEFAULT_TTL
+	if ttlValues, ok := r.PostForm["ttl"]; ok {
+		ttlParam, err := strconv.Atoi(ttlValues[0])
+		if err != nil || ttlParam <= 0 || ttlParam > MAX_TTL {
+			incorrect = append(incorrect, "ttl")
+		}
+		ttl = ttlParam
+	}
+	if len(incorrect) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("incorrect fields: " + strings.Join(incorrect, ", ")))
+		return
+	}
+
+	id, key, value, salt, passphraseHash, err := sealSecret(secret, r.PostForm.Get("passphrase"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not encrypt secret: %v", err)
+		return
+	}
+
+	expiresOn := time.Now().Add(time.Duration(ttl) * time.Second).UTC().Truncate(time.Second)
+	if err := dbhelper.CreateSecret(id, value, salt, passphraseHash, expiresOn); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not create secret: %v", err)
+		return
+	}
+
+	result := struct {
+		ID        string    `json:"id"`
+		Key       string    `json:"key"`
+		Link      string    `json:"link"`
+		ExpiresOn time.Time `json:"expiresOn"`
+	}{
+		ID:        id,
+		Key:       key,
+		Link:      "/secrets/" + id + "#" + key,
+		ExpiresOn: expiresOn,
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize secret to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// SecretStatus - GET /secrets/{id:[0-9a-f]{32}}
+// Checks a secret without revealing it, so that link previews do not destroy it
+// Returns:
+// - secret status in JSON format, status code 404 if the secret was already revealed or has expired:
+//   "passphraseRequired": boolean,
+//   "expiresOn": string, RFC 3339 time
+func SecretStatus(w http.ResponseWriter, r *http.Request) {
+	secret, err := findSecret(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not retrieve secret: %v", err)
+		return
+	}
+	if secret == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	result := struct {
+		PassphraseRequired bool      `json:"passphraseRequired"`
+		ExpiresOn          time.Time `json:"expiresOn"`
+	}{
+		PassphraseRequired: secret.PassphraseSalt != "",
+		ExpiresOn:          secret.ExpiresOn,
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize secret status to json: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// RevealSecret - POST /secrets/{id:[0-9a-f]{32}}
+// The server never receives the link key: it checks the passphrase, destroys the secret and returns it encrypted,
+// the client decrypts it with AES-256-GCM under SHA-256(key || passphraseKey), the nonce being the first 12 bytes
+// of the value and the id the additional data
+// Params:
+// - passphrase: string (required if the secret was created with a passphrase)
+// Returns:
+// - the encrypted secret in JSON format, which is destroyed afterwards; status code 404 if the secret was already
+//   revealed or has expired, 400 on a wrong passphrase, which destroys the secret after MAX_PASSPHRASE_ATTEMPTS
+//   wrong passphrases:
+//   "value": string, base64-encoded nonce and ciphertext,
+//   "passphraseKey": string, base64url-encoded scrypt hash of the passphrase, if the secret has a passphrase
+func RevealSecret(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	secret, err := findSecret(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not retrieve secret: %v", err)
+		return
+	}
+	if secret == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// attempts are counted before the passphrase is checked, so that concurrent guesses can not exceed the limit
+	if secret.PassphraseSalt != "" {
+		counted, err := countSecretAttempt(secret.ID, MAX_PASSPHRASE_ATTEMPTS)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("can not count passphrase attempt: %v", err)
+			return
+		}
+		if !counted {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+
+	passphraseKey, err := checkPassphrase(r.PostForm.Get("passphrase"), secret.PassphraseSalt, secret.PassphraseHash)
+	if err == errWrongPassphrase {
+		if secret.PassphraseSalt != "" {
+			deleted, err := deleteExhaustedSecret(secret.ID, MAX_PASSPHRASE_ATTEMPTS)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				log.Printf("can not delete secret: %v", err)
+				return
+			}
+			if deleted {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("wrong passphrase - the secret was destroyed after " + strconv.Itoa(MAX_PASSPHRASE_ATTEMPTS) + " attempts"))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("wrong passphrase"))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not check passphrase: %v", err)
+		return
+	}
+
+	// only the request which deletes the secret may reveal it
+	deleted, err := deleteSecret(secret.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not delete secret: %v", err)
+		return
+	}
+	if !deleted {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	result := struct {
+		Value         string `json:"value"`
+		PassphraseKey string `json:"passphraseKey,omitempty"`
+	}{
+		Value:         secret.Value,
+		PassphraseKey: base64.RawURLEncoding.EncodeToString(passphraseKey),
+	}
+	json, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("can not serialize secret to json: %v", err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// StartCleanup periodically deletes expired secrets in the background
+func StartCleanup(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			count, err := dbhelper.DeleteExpiredSecrets()
+			if err != nil {
+				log.Printf("can not delete expired secrets: %v", err)
+			} else if count > 0 {
+				log.Printf("deleted %v expired secrets", count)
+			}
+		}
+	}()
+}
+
+// sealSecret encrypts the secret with AES-256-GCM under a fresh random key, bound to a fresh random id;
+// with a passphrase, the key is combined with its scrypt hash, of which only a SHA-256 hash is stored
+func sealSecret(secret, passphrase string) (id, key, value, salt, passphraseHash string, err error) {
+	idBytes := make([]byte, 16)
+	keyBytes := make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, idBytes); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(rand.Reader, keyBytes); err != nil {
+		return
+	}
+	id = hex.EncodeToString(idBytes)
+	key = base64.RawURLEncoding.EncodeToString(keyBytes)
+
+	var passphraseKey []byte
+	if passphrase != "" {
+		saltBytes := make([]byte, 16)
+		if _, err = io.ReadFull(rand.Reader, saltBytes); err != nil {
+			return
+		}
+		if passphraseKey, err = derivePassphraseKey(passphrase, saltBytes); err != nil {
+			return
+		}
+		salt = hex.EncodeToString(saltBytes)
+		hash := sha256.Sum256(passphraseKey)
+		passphraseHash = hex.EncodeToString(hash[:])
+	}
+
+	aead, err := newSecretCipher(keyBytes, passphraseKey)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(id))
+	value = base64.StdEncoding.EncodeToString(sealed)
+	return
+}
+
+// checkPassphrase returns the scrypt hash of the passphrase if it matches the stored hash, nil for secrets without
+// a passphrase
+func checkPassphrase(passphrase, salt, passphraseHash string) ([]byte, error) {
+	if salt == "" {
+		if passphrase != "" {
+			return nil, errWrongPassphrase
+		}
+		return nil, nil
+	}
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		return nil, err
+	}
+	passphraseKey, err := derivePassphraseKey(passphrase, saltBytes)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(passphraseKey)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(hash[:])), []byte(passphraseHash)) != 1 {
+		return nil, errWrongPassphrase
+	}
+	return passphraseKey, nil
+}
+
+func derivePassphraseKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// newSecretCipher derives the encryption key from the link key and, when set, the scrypt hash of the passphrase
+func newSecretCipher(key, passphraseKey []byte) (cipher.AEAD, error) {
+	hasher := sha256.New()
+	hasher.Write(key)
+	hasher.Write(passphraseKey)
+
+	block, err := aes.NewCipher(hasher.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
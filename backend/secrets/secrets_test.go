@@ -0,0 +1,202 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"../dbhelper"
+	"github.com/gorilla/mux"
+)
+
+var errWrongKey = errors.New("secrets: wrong key or passphrase")
+
+func TestSealOpen(t *testing.T) {
+	secret := "correct horse battery staple"
+	id, key, value, salt, passphraseHash, err := sealSecret(secret, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if salt != "" || passphraseHash != "" {
+		t.Error("sealSecret generated a salt without a passphrase")
+	}
+
+	plainText, err := openSecret(id, key, nil, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plainText != secret {
+		t.Error("sealSecret and openSecret are not inverse operations")
+	}
+
+	_, otherKey, _, _, _, err := sealSecret(secret, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openSecret(id, otherKey, nil, value); err != errWrongKey {
+		t.Errorf("openSecret accepted a wrong key: %v", err)
+	}
+	if _, err := checkPassphrase("passphrase", salt, passphraseHash); err != errWrongPassphrase {
+		t.Errorf("checkPassphrase accepted a passphrase for a secret without one: %v", err)
+	}
+}
+
+func TestSealOpenPassphrase(t *testing.T) {
+	secret := "correct horse battery staple"
+	id, key, value, salt, passphraseHash, err := sealSecret(secret, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkPassphrase("", salt, passphraseHash); err != errWrongPassphrase {
+		t.Errorf("checkPassphrase accepted a missing passphrase: %v", err)
+	}
+	if _, err := checkPassphrase("wrong passphrase", salt, passphraseHash); err != errWrongPassphrase {
+		t.Errorf("checkPassphrase accepted a wrong passphrase: %v", err)
+	}
+	if _, err := openSecret(id, key, nil, value); err != errWrongKey {
+		t.Errorf("openSecret decrypted without the passphrase key: %v", err)
+	}
+
+	passphraseKey, err := checkPassphrase("passphrase", salt, passphraseHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainText, err := openSecret(id, key, passphraseKey, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plainText != secret {
+		t.Error("sealSecret and openSecret are not inverse operations")
+	}
+}
+
+func TestRevealSecretPassphraseAttempts(t *testing.T) {
+	id, key, value, salt, passphraseHash, err := sealSecret("correct horse battery staple", "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSecretStore(t, dbhelper.Secret{ID: id, Value: value, PassphraseSalt: salt, PassphraseHash: passphraseHash, ExpiresOn: time.Now().Add(time.Hour)})
+
+	for attempt := 1; attempt <= MAX_PASSPHRASE_ATTEMPTS; attempt++ {
+		rr := revealSecret(id, "wrong passphrase")
+		expected := "wrong passphrase"
+		if attempt == MAX_PASSPHRASE_ATTEMPTS {
+			expected = "wrong passphrase - the secret was destroyed after 5 attempts"
+		}
+		if rr.Code != http.StatusBadRequest || rr.Body.String() != expected {
+			t.Errorf("RevealSecret returned unexpected response on attempt %v: got: %v %v, expected: %v", attempt, rr.Code, rr.Body.String(), expected)
+		}
+	}
+	if rr := revealSecret(id, "passphrase"); rr.Code != http.StatusNotFound {
+		t.Errorf("RevealSecret returned incorrect status code after too many attempts: got: %v, expected: %v", rr.Code, http.StatusNotFound)
+	}
+
+	// fewer wrong passphrases do not prevent revealing the secret
+	id, key, value, salt, passphraseHash, err = sealSecret("correct horse battery staple", "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSecretStore(t, dbhelper.Secret{ID: id, Value: value, PassphraseSalt: salt, PassphraseHash: passphraseHash, ExpiresOn: time.Now().Add(time.Hour)})
+	for attempt := 1; attempt < MAX_PASSPHRASE_ATTEMPTS; attempt++ {
+		revealSecret(id, "wrong passphrase")
+	}
+	rr := revealSecret(id, "passphrase")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("RevealSecret returned incorrect status code: got: %v, expected: %v", rr.Code, http.StatusOK)
+	}
+	var result struct {
+		Value         string `json:"value"`
+		PassphraseKey string `json:"passphraseKey"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	passphraseKey, err := base64.RawURLEncoding.DecodeString(result.PassphraseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plainText, err := openSecret(id, key, passphraseKey, result.Value); err != nil || plainText != "correct horse battery staple" {
+		t.Errorf("RevealSecret returned a secret which does not decrypt: %v", err)
+	}
+}
+
+// useSecretStore replaces the database access with an in-memory store holding the secret
+func useSecretStore(t *testing.T, secret dbhelper.Secret) {
+	attempts := 0
+	stored := true
+	findSecret = func(id string) (*dbhelper.Secret, error) {
+		if !stored || id != secret.ID {
+			return nil, nil
+		}
+		return &secret, nil
+	}
+	deleteSecret = func(id string) (bool, error) {
+		deleted := stored && id == secret.ID
+		stored = stored && !deleted
+		return deleted, nil
+	}
+	countSecretAttempt = func(id string, maxAttempts int) (bool, error) {
+		if !stored || id != secret.ID || attempts >= maxAttempts {
+			return false, nil
+		}
+		attempts++
+		return true, nil
+	}
+	deleteExhaustedSecret = func(id string, maxAttempts int) (bool, error) {
+		if !stored || id != secret.ID || attempts < maxAttempts {
+			return false, nil
+		}
+		stored = false
+		return true, nil
+	}
+	t.Cleanup(func() {
+		findSecret = dbhelper.FindSecret
+		deleteSecret = dbhelper.DeleteSecret
+		countSecretAttempt = dbhelper.CountSecretAttempt
+		deleteExhaustedSecret = dbhelper.DeleteExhaustedSecret
+	})
+}
+
+func revealSecret(id, passphrase string) *httptest.ResponseRecorder {
+	payload := url.Values{"passphrase": {passphrase}}
+	req := httptest.NewRequest("POST", "/secrets/"+id, strings.NewReader(payload.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(RevealSecret)
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// openSecret decrypts a revealed secret as clients do, with the link key and the passphrase key, if any
+func openSecret(id, key string, passphraseKey []byte, value string) (string, error) {
+	keyBytes, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(keyBytes) != 32 {
+		return "", errWrongKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newSecretCipher(keyBytes, passphraseKey)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("secrets: stored value is too short")
+	}
+	plainText, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", errWrongKey
+	}
+	return string(plainText), nil
+}
@@ -27,11 +27,41 @@ CREATE TABLE user_keys (
 	FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
+CREATE TABLE issued_certificates (
+	id INT AUTO_INCREMENT NOT NULL,
+	ca_key_id INT NOT NULL,
+	serial_number VARCHAR(40) NOT NULL,
+	subject TEXT NOT NULL,
+	certificate TEXT NOT NULL,
+	issued_on DATETIME NOT NULL,
+	expires_on DATETIME NOT NULL,
+	revoked_on DATETIME NULL,
+	revocation_reason INT NOT NULL DEFAULT 0,
+	PRIMARY KEY (id),
+	UNIQUE (ca_key_id, serial_number),
+	FOREIGN KEY (ca_key_id) REFERENCES user_keys(id) ON DELETE CASCADE
+);
+
+CREATE TABLE shared_secrets (
+	id CHAR(32) NOT NULL,
+	secret_value TEXT NOT NULL,
+	passphrase_salt VARCHAR(32) NOT NULL DEFAULT '',
+	passphrase_hash CHAR(64) NOT NULL DEFAULT '',
+	failed_attempts INT NOT NULL DEFAULT 0,
+	expires_on DATETIME NOT NULL,
+	PRIMARY KEY (id),
+	INDEX (expires_on)
+);
+
 INSERT INTO key_types (key_type_name) VALUES ('RSA');
 INSERT INTO key_types (key_type_name) VALUES ('AES');
 INSERT INTO key_types (key_type_name) VALUES ('Blowfish');
 INSERT INTO key_types (key_type_name) VALUES ('Twofish');
 INSERT INTO key_types (key_type_name) VALUES ('Password');
+INSERT INTO key_types (key_type_name) VALUES ('ECDSA');
+INSERT INTO key_types (key_type_name) VALUES ('X.509');
+INSERT INTO key_types (key_type_name) VALUES ('TOTP');
+INSERT INTO key_types (key_type_name) VALUES ('SSH');
 
 /* sample user: Test / Test */
 INSERT INTO users (username, password_hash, salt) VALUES ('Test', 'eb1b7f79e2d2a815f9a29048aa34c7beaf05425045569e83a8b8011f8bbd735b', '2jK@7mKeMQzY:4v?WTg-50r6M+chHnHl');
@@ -14,6 +14,7 @@ import { SettingsComponent } from './components/settings/settings.component';
 import { AuthenticationService } from './services/authentication.service';
 import { AuthGuard } from './services/auth-guard.service';
 import { KeyComponent } from './components/key-store/key.component';
+import { SecretComponent } from './components/secrets/secret.component';
 
 const appRoutes : Routes = [
   { path: '', component: EncryptionComponent },
@@ -22,6 +23,7 @@ const appRoutes : Routes = [
   { path: 'key-generation', component: KeyGenerationComponent },
   { path: 'key-store', canActivate: [AuthGuard], component: KeyStoreComponent },
   { path: 'login', component: LoginComponent },
+  { path: 'secrets/:id', component: SecretComponent },
   { path: 'settings', canActivate: [AuthGuard], component: SettingsComponent }
 ];
 
@@ -34,7 +36,8 @@ const appRoutes : Routes = [
     KeyStoreComponent,
     LoginComponent,
     SettingsComponent,
-    KeyComponent
+    KeyComponent,
+    SecretComponent
   ],
   imports: [
     BrowserModule,
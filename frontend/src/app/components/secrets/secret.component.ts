@@ -0,0 +1,94 @@
+import { Component, OnInit, ViewChild, ElementRef } from '@angular/core';
+import { ActivatedRoute } from '@angular/router';
+import { SecretsService } from './secrets.service';
+
+@Component({
+  selector: 'app-secret',
+  templateUrl: './secret.component.html',
+  styleUrls: ['./secret.component.css']
+})
+export class SecretComponent implements OnInit {
+
+  constructor(private route: ActivatedRoute, private service: SecretsService) { }
+
+  available: boolean = false;
+  passphraseRequired: boolean = false;
+  expiresOn: string = "";
+  passphrase: string = "";
+  result: string = "";
+  errors: Array<string> = [];
+  private id: string = "";
+  private key: string = "";
+
+  @ViewChild('textareaResult') textareaResultElement: ElementRef;
+
+  ngOnInit() {
+    this.id = this.route.snapshot.paramMap.get('id');
+    // the key is kept in the fragment, which browsers do not send to the server
+    this.key = this.route.snapshot.fragment || "";
+    if(this.key.length == 0){
+      this.errors.push("The link is incomplete, the decryption key is missing.");
+      return;
+    }
+
+    this.service.getSecretStatus(this.id).then(
+      status => {
+        this.available = true;
+        this.passphraseRequired = status["passphraseRequired"];
+        this.expiresOn = status["expiresOn"];
+      },
+      error => {
+        //console.log(error);
+        if(error.status == 404){
+          this.errors.push("This secret was already revealed or has expired.");
+        }else if(error.status == 500){
+          this.errors.push(error.statusText);
+        }else{
+          this.errors.push(error.message);
+        }
+      }
+    );
+  }
+
+  onReveal() {
+    this.errors = [];
+    if(this.passphraseRequired && this.passphrase.length == 0){
+      this.errors.push("Passphrase is empty.");
+      return;
+    }
+
+    this.service.revealSecret(this.id, this.passphrase).then(
+      response => {
+        // the secret is destroyed on the server once revealed
+        this.available = false;
+        this.service.decryptSecret(this.id, this.key, response["passphraseKey"], response["value"]).then(
+          secret => {
+            this.result = secret;
+          },
+          _ => {
+            this.errors.push("The secret can not be decrypted, the link is damaged.");
+          }
+        );
+      },
+      error => {
+        //console.log(error);
+        if(error.status == 400){
+          this.errors.push(error.error);
+        }else if(error.status == 404){
+          this.available = false;
+          this.errors.push("This secret was already revealed or has expired.");
+        }else if(error.status == 500){
+          this.errors.push(error.statusText);
+        }else{
+          this.errors.push(error.message);
+        }
+      }
+    );
+  }
+
+  onCopyToClipboardClick() {
+    this.textareaResultElement.nativeElement.select();
+    document.execCommand('copy');
+    return false;
+  }
+}
@@ -0,0 +1,76 @@
+import { Injectable } from '@angular/core';
+import { HttpClient, HttpHeaders } from '@angular/common/http';
+import { environment as env } from '../../../environments/environment';
+
+@Injectable({
+  providedIn: 'root'
+})
+export class SecretsService {
+
+  constructor(private http: HttpClient) { }
+
+  getSecretStatus(id: string) {
+    return new Promise((resolve, reject) => {
+      this.http.get<any>(`${env.appBackend}/secrets/${id}`)
+        .subscribe(
+          response => resolve(response),
+          error => reject(error)
+      );
+    });
+  }
+
+  revealSecret(id: string, passphrase: string) {
+    return new Promise((resolve, reject) => {
+      let body = new URLSearchParams();
+      if(passphrase.length > 0){
+        body.set('passphrase', passphrase);
+      }
+      let options = {
+        headers: new HttpHeaders()
+                      .set('Content-Type', 'application/x-www-form-urlencoded')
+      };
+      this.http.post<any>(`${env.appBackend}/secrets/${id}`, body.toString(), options)
+        .subscribe(
+          response => resolve(response),
+          error => reject(error)
+      );
+    });
+  }
+
+  // decrypts a revealed secret with AES-256-GCM under SHA-256(key || passphraseKey), the nonce being
+  // the first 12 bytes of the value and the id the additional data
+  decryptSecret(id: string, key: string, passphraseKey: string, value: string) {
+    let keyBytes = this.decodeBase64Url(key);
+    let passphraseKeyBytes = passphraseKey ? this.decodeBase64Url(passphraseKey) : new Uint8Array(0);
+    let keyMaterial = new Uint8Array(keyBytes.length + passphraseKeyBytes.length);
+    keyMaterial.set(keyBytes);
+    keyMaterial.set(passphraseKeyBytes, keyBytes.length);
+    let sealed = this.decodeBase64(value);
+
+    return crypto.subtle.digest('SHA-256', keyMaterial)
+      .then(hash => crypto.subtle.importKey('raw', hash, { name: 'AES-GCM' }, false, ['decrypt']))
+      .then(cryptoKey => crypto.subtle.decrypt(
+        { name: 'AES-GCM', iv: sealed.slice(0, 12), additionalData: new TextEncoder().encode(id) },
+        cryptoKey,
+        sealed.slice(12)
+      ))
+      .then(plainText => new TextDecoder().decode(plainText));
+  }
+
+  private decodeBase64Url(encoded: string) : Uint8Array {
+    let base64 = encoded.replace(/-/g, '+').replace(/_/g, '/');
+    while(base64.length % 4 != 0){
+      base64 += '=';
+    }
+    return this.decodeBase64(base64);
+  }
+
+  private decodeBase64(encoded: string) : Uint8Array {
+    let binary = atob(encoded);
+    let bytes = new Uint8Array(binary.length);
+    for(let i = 0; i < binary.length; i++){
+      bytes[i] = binary.charCodeAt(i);
+    }
+    return bytes;
+  }
+}
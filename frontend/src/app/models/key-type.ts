@@ -3,5 +3,9 @@ export enum KeyType {
     AES = "AES",
     Blowfish = "Blowfish",
     Twofish = "Twofish",
-    Password = "Password"
+    Password = "Password",
+    ECDSA = "ECDSA",
+    X509 = "X.509",
+    TOTP = "TOTP",
+    SSH = "SSH"
 }
\ No newline at end of file